@@ -4,10 +4,15 @@ go 1.20
 
 require (
 	github.com/alecthomas/chroma/v2 v2.12.0
+	github.com/creack/pty v1.1.21
 	github.com/google/go-cmp v0.5.9
+	github.com/klauspost/compress v1.17.4
+	github.com/pierrec/lz4/v4 v4.1.21
 	github.com/sirupsen/logrus v1.8.1
-	golang.org/x/sys v0.1.0
+	github.com/ulikunitz/xz v0.5.11
+	golang.org/x/sys v0.7.0
 	golang.org/x/term v0.0.0-20210503060354-a79de5458b56
+	golang.org/x/text v0.14.0
 	gotest.tools/v3 v3.3.0
 )
 
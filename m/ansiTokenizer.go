@@ -22,10 +22,16 @@ var manPageUnderline = twin.StyleDefault.WithAttr(twin.AttrUnderline)
 var standoutStyle *twin.Style = nil
 var unprintableStyle UnprintableStyle = UNPRINTABLE_STYLE_HIGHLIGHT
 
+// What our syntax highlighting adds to lines
+var sgrSequence = regexp.MustCompile("\x1b\\[[0-9;:]*m")
+
 // A Line represents a line of text that can / will be paged
 type Line struct {
 	raw   string
 	plain *string
+
+	// Set if raw got its colors from our own syntax highlighting
+	highlighted bool
 }
 
 type cellsWithTrailer struct {
@@ -80,6 +86,14 @@ func (line *Line) Plain(lineNumberOneBased *int) string {
 	return *line.plain
 }
 
+// The line as we read it, without any highlighting we added ourselves
+func (line *Line) input() string {
+	if !line.highlighted {
+		return line.raw
+	}
+	return sgrSequence.ReplaceAllLiteralString(line.raw, "")
+}
+
 func setStyle(updateMe *twin.Style, envVarName string, fallback *twin.Style) {
 	envValue := os.Getenv(envVarName)
 	if envValue == "" {
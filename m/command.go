@@ -0,0 +1,118 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/creack/pty"
+	log "github.com/sirupsen/logrus"
+)
+
+// Terminal size for commands when we can't tell the size of our own terminal
+const _DefaultCommandWidth = 80
+const _DefaultCommandHeight = 24
+
+// Reads from the controlling side of a pseudo terminal.
+//
+// On Linux, reading from a pty whose other side has been closed fails with
+// EIO rather than returning EOF. This turns that into a proper EOF.
+type _PtyReader struct {
+	pty *os.File
+}
+
+func (r _PtyReader) Read(p []byte) (int, error) {
+	n, err := r.pty.Read(p)
+	if errors.Is(err, syscall.EIO) {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// NewReaderFromCommand creates a new Reader showing the output of a command.
+//
+// The command is started inside of a pseudo terminal, so that it keeps its
+// colors just like when it is run in a terminal. Both stdout and stderr end up
+// in the Reader.
+//
+// Once the command is done, its exit status is shown in the status bar.
+//
+// Readers created by this function can be reloaded in the pager, which runs
+// the command again.
+func NewReaderFromCommand(command []string) (*Reader, error) {
+	return NewReaderFromCommandWithOptions(command, ReaderOptions{})
+}
+
+// NewReaderFromCommandWithOptions is like NewReaderFromCommand(), but the
+// encoding, language and such can be forced using ReaderOptions.
+func NewReaderFromCommandWithOptions(command []string, options ReaderOptions) (*Reader, error) {
+	if len(command) == 0 {
+		return nil, errors.New("no command to run")
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	ptyFile, err := pty.StartWithSize(cmd, commandWindowSize())
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newReader()
+	reader.options = options
+	reader.highlightingDone.Store(true) // Commands do their own coloring = nothing left to do = Done!
+	name := strings.Join(command, " ")
+	reader.name = &name
+	title := "$ " + name
+	reader.title = &title
+	reader.command = command
+	reader.reloader = func() (*Reader, error) {
+		return NewReaderFromCommandWithOptions(command, options)
+	}
+
+	go func() {
+		reader.readStream(_PtyReader{pty: ptyFile}, nil, nil)
+
+		// All output read, which means the command is done with its terminal
+		err := ptyFile.Close()
+		if err != nil {
+			log.Debugf("Closing the pty of %v failed: %s", command, err)
+		}
+	}()
+	go reader.waitForCommand(cmd)
+
+	return reader, nil
+}
+
+// Make the command believe its terminal is the same size as ours
+func commandWindowSize() *pty.Winsize {
+	size, err := pty.GetsizeFull(os.Stdout)
+	if err == nil && size.Cols > 0 && size.Rows > 0 {
+		return size
+	}
+
+	return &pty.Winsize{Cols: _DefaultCommandWidth, Rows: _DefaultCommandHeight}
+}
+
+// Wait for the command to exit, and report its exit status in the status bar
+func (reader *Reader) waitForCommand(cmd *exec.Cmd) {
+	err := cmd.Wait()
+
+	var exitError *exec.ExitError
+	reader.Lock()
+	if err == nil || errors.As(err, &exitError) {
+		exitStatus := cmd.ProcessState.String()
+		reader.exitStatus = &exitStatus
+	} else if reader.err == nil {
+		reader.err = fmt.Errorf("waiting for command failed: %w", err)
+	}
+	reader.Unlock()
+
+	// Make the pager redraw the status bar
+	select {
+	case reader.moreLinesAdded <- true:
+	default:
+	}
+}
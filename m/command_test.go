@@ -0,0 +1,93 @@
+//go:build !windows
+// +build !windows
+
+package m
+
+import (
+	"os"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// Wait for the command of some Reader to exit, and return its exit status
+func waitForExitStatus(t *testing.T, reader *Reader) string {
+	assert.NilError(t, reader._wait())
+
+	var exitStatus *string
+	waitFor(t, "Command never exited", func() bool {
+		reader.Lock()
+		defer reader.Unlock()
+		exitStatus = reader.exitStatus
+		return exitStatus != nil
+	})
+
+	return *exitStatus
+}
+
+func TestCommandInPty(t *testing.T) {
+	reader, err := NewReaderFromCommand([]string{"sh", "-c", "test -t 1 && echo 'stdout is a tty'; echo oops >&2; exit 3"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, waitForExitStatus(t, reader), "exit status 3")
+	assert.DeepEqual(t, readLines(t, reader), []string{"stdout is a tty", "oops"})
+
+	lines, _ := reader.GetLines(1, 2)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "$ sh -c "), lines.statusText)
+	assert.Assert(t, strings.HasSuffix(lines.statusText, "  exit status 3"), lines.statusText)
+
+	// A failing command is not a problem with reading its output
+	summary, _ := reader.problems()
+	assert.Equal(t, summary, "")
+}
+
+func TestCommandKeepsColors(t *testing.T) {
+	reader, err := NewReaderFromCommand([]string{"printf", "\\033[31mred\\033[m\\n"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, waitForExitStatus(t, reader), "exit status 0")
+	assert.Equal(t, reader.GetLine(1).raw, "\x1b[31mred\x1b[m")
+}
+
+func TestReloadCommand(t *testing.T) {
+	reader, err := NewReaderFromCommand([]string{"echo", "hello"})
+	assert.NilError(t, err)
+	waitForExitStatus(t, reader)
+
+	reloaded, err := reader.reload()
+	assert.NilError(t, err)
+	assert.Assert(t, reloaded != nil)
+	waitForExitStatus(t, reloaded)
+	assert.DeepEqual(t, readLines(t, reloaded), []string{"hello"})
+}
+
+func TestCommandClosesPty(t *testing.T) {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("Can't count open files: ", err)
+	}
+	before := len(fds)
+
+	// Otherwise finalizers close leaked files
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+
+	for i := 0; i < 50; i++ {
+		reader, err := NewReaderFromCommand([]string{"true"})
+		assert.NilError(t, err)
+		waitForExitStatus(t, reader)
+	}
+
+	// The pty is closed right after the Reader is done
+	time.Sleep(100 * time.Millisecond)
+	fds, err = os.ReadDir("/proc/self/fd")
+	assert.NilError(t, err)
+	assert.Assert(t, len(fds) < before+5, "%d open files before, %d after", before, len(fds))
+}
+
+func TestMissingCommand(t *testing.T) {
+	_, err := NewReaderFromCommand([]string{"this-command-does-not-exist"})
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,128 @@
+package m
+
+import "github.com/walles/moar/twin"
+
+// True if we're showing a cursor for picking lines, in directory listings and
+// in JSON views
+func (p *Pager) hasCursor() bool {
+	return p.reader.directory != nil || p.reader.isShowingJson()
+}
+
+// The line number of the line under the cursor. The cursor is kept on screen,
+// so scrolling moves the cursor as well.
+func (p *Pager) cursorLineOneBased() int {
+	firstVisible := p.lineNumberOneBased()
+	lastVisible := firstVisible + p.visibleHeight() - 1
+	lineCount := p.reader.GetLineCount()
+	if lastVisible > lineCount {
+		lastVisible = lineCount
+	}
+
+	selected := p.cursor
+	if selected > lastVisible {
+		selected = lastVisible
+	}
+	if selected < firstVisible {
+		selected = firstVisible
+	}
+
+	return selected
+}
+
+// Handles the cursor keys of directory listings and JSON views. Returns false
+// for other keys.
+func (p *Pager) onCursorKey(key twin.KeyCode) bool {
+	if !p.hasCursor() {
+		return false
+	}
+
+	switch key {
+	case twin.KeyUp:
+		p.moveCursor(-1)
+	case twin.KeyDown:
+		p.moveCursor(1)
+	case twin.KeyEnter:
+		if p.reader.directory != nil {
+			p.openDirectoryEntry()
+		} else {
+			p.toggleJsonFold()
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Like onCursorKey(), but for 'j' and 'k', plus '+' and '-' for unfolding and
+// folding everything in JSON views
+func (p *Pager) onCursorRune(char rune) bool {
+	if !p.hasCursor() {
+		return false
+	}
+
+	switch char {
+	case 'k':
+		p.moveCursor(-1)
+	case 'j':
+		p.moveCursor(1)
+	case '+', '-':
+		if p.reader.directory != nil {
+			return false
+		}
+		p.foldAllJson(char == '-')
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Move the cursor up (negative delta) or down, scrolling when it reaches the
+// top or bottom of the screen
+func (p *Pager) moveCursor(delta int) {
+	selected := p.cursorLineOneBased() + delta
+	if selected < 1 || selected > p.reader.GetLineCount() {
+		return
+	}
+
+	firstVisible := p.lineNumberOneBased()
+	if selected < firstVisible {
+		p.scrollPosition = p.scrollPosition.PreviousLine(1)
+		p.handleScrolledUp()
+	} else if selected >= firstVisible+p.visibleHeight() {
+		p.scrollPosition = p.scrollPosition.NextLine(1)
+		p.handleScrolledDown()
+	}
+
+	p.cursor = selected
+}
+
+// Show the cursor as a full width bar
+func (p *Pager) markCursor(renderedLines []renderedLine) {
+	if !p.hasCursor() {
+		return
+	}
+
+	selected := p.cursorLineOneBased()
+	for i := range renderedLines {
+		if renderedLines[i].inputLineOneBased != selected {
+			continue
+		}
+
+		for j := range renderedLines[i].cells {
+			renderedLines[i].cells[j].Style = renderedLines[i].cells[j].Style.WithAttr(twin.AttrReverse)
+		}
+		renderedLines[i].trailer = twin.StyleDefault.WithAttr(twin.AttrReverse)
+	}
+}
+
+// Put the cursor on a line, scrolling it into view if needed
+func (p *Pager) moveCursorTo(lineNumberOneBased int) {
+	firstVisible := p.lineNumberOneBased()
+	if lineNumberOneBased < firstVisible || lineNumberOneBased >= firstVisible+p.visibleHeight() {
+		p.scrollPosition = NewScrollPositionFromLineNumberOneBased(lineNumberOneBased, "moveCursorTo")
+	}
+
+	p.cursor = lineNumberOneBased
+}
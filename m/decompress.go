@@ -0,0 +1,114 @@
+package m
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/ulikunitz/xz"
+)
+
+// Magic bytes at the start of compressed streams
+var gzipMagic = []byte{0x1f, 0x8b}
+var bzip2Magic = []byte("BZh") // Followed by a block size digit, see isBzip2()
+var xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+var lz4Magic = []byte{0x04, 0x22, 0x4d, 0x18}
+
+// Enough bytes to hold the longest magic above
+const _MagicLength = 6
+
+func isCompressed(header []byte) bool {
+	for _, magic := range [][]byte{gzipMagic, xzMagic, zstdMagic, lz4Magic} {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+
+	return isBzip2(header)
+}
+
+// "BZh" alone is too common at the start of text files, so also require the
+// block size digit that comes after it in real bzip2 streams.
+func isBzip2(header []byte) bool {
+	if !bytes.HasPrefix(header, bzip2Magic) || len(header) <= len(bzip2Magic) {
+		return false
+	}
+
+	blockSize := header[len(bzip2Magic)]
+	return blockSize >= '1' && blockSize <= '9'
+}
+
+// Does this file start with the magic bytes of any compression format we know
+// how to decompress?
+func isCompressedFile(filename string) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Warn("Error closing file after checking for compression: ", err)
+		}
+	}()
+
+	header := make([]byte, _MagicLength)
+	headerLength, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return isCompressed(header[:headerLength]), nil
+}
+
+// Returns a stream with the contents of the given stream, transparently
+// decompressed if it starts with the magic bytes of some compression format we
+// know about. Uncompressed streams are returned as-is, just buffered.
+//
+// Note that this will block until enough of the stream is available to tell
+// whether or not it is compressed.
+func decompressingReader(stream io.Reader) (io.Reader, error) {
+	bufferedStream := bufio.NewReader(stream)
+	header, err := bufferedStream.Peek(_MagicLength)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(header, gzipMagic) {
+		log.Debug("Decompressing gzip stream")
+		return gzip.NewReader(bufferedStream)
+	}
+
+	if isBzip2(header) {
+		log.Debug("Decompressing bzip2 stream")
+		return bzip2.NewReader(bufferedStream), nil
+	}
+
+	if bytes.HasPrefix(header, xzMagic) {
+		log.Debug("Decompressing xz stream")
+		return xz.NewReader(bufferedStream)
+	}
+
+	if bytes.HasPrefix(header, zstdMagic) {
+		log.Debug("Decompressing zstd stream")
+		decoder, err := zstd.NewReader(bufferedStream)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	if bytes.HasPrefix(header, lz4Magic) {
+		log.Debug("Decompressing lz4 stream")
+		return lz4.NewReader(bufferedStream), nil
+	}
+
+	return bufferedStream, nil
+}
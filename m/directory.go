@@ -0,0 +1,232 @@
+package m
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const _DirectoryTimeFormat = "2006-01-02 15:04"
+
+// A directory shown as a listing, one entry per line
+type _Directory struct {
+	path string
+
+	// Entry names, in the same order as the lines of the listing
+	entries []string
+
+	// Creates a Reader for an entry in this directory
+	open func(path string) (*Reader, error)
+}
+
+// A view we came from, returned to when the user quits the nested one
+type _ParentView struct {
+	reader                   *Reader
+	scrollPosition           scrollPosition
+	leftColumnZeroBased      int
+	targetLineNumberOneBased int
+	cursor                   int
+}
+
+func isDirectory(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.IsDir()
+}
+
+// NewReaderFromDirectory creates a Reader listing the contents of a
+// directory, with sizes and modification times.
+//
+// In the pager, pressing RETURN on an entry opens it in a nested view, and
+// quitting the nested view returns to the listing. Files are opened using
+// NewReaderFromFilename() with the style and formatter given here.
+func NewReaderFromDirectory(dirname string, style chroma.Style, formatter chroma.Formatter) (*Reader, error) {
+	return NewReaderFromDirectoryWithOptions(dirname, style, formatter, ReaderOptions{})
+}
+
+// NewReaderFromDirectoryWithOptions is like NewReaderFromDirectory(), but the
+// files opened from the listing get the given ReaderOptions.
+func NewReaderFromDirectoryWithOptions(dirname string, style chroma.Style, formatter chroma.Formatter, options ReaderOptions) (*Reader, error) {
+	open := func(path string) (*Reader, error) {
+		if isDirectory(path) {
+			return NewReaderFromDirectoryWithOptions(path, style, formatter, options)
+		}
+		return NewReaderFromFilenameWithOptions(path, style, formatter, options)
+	}
+
+	return newReaderFromDirectory(dirname, open)
+}
+
+func newReaderFromDirectory(dirname string, open func(path string) (*Reader, error)) (*Reader, error) {
+	lines, entries, err := listDirectory(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := NewReaderFromText(dirname, strings.Join(lines, "\n"))
+	reader.directory = &_Directory{
+		path:    dirname,
+		entries: entries,
+		open:    open,
+	}
+	reader.reloader = func() (*Reader, error) {
+		return newReaderFromDirectory(dirname, open)
+	}
+
+	return reader, nil
+}
+
+// Returns one line per directory entry, and the entry names in the same order.
+// Directories go first, and the parent directory goes first of all.
+func listDirectory(dirname string) ([]string, []string, error) {
+	dirEntries, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type listedEntry struct {
+		name    string
+		isDir   bool
+		size    string
+		modTime string
+	}
+
+	listed := []listedEntry{}
+	absolute, err := filepath.Abs(dirname)
+	if err == nil && filepath.Dir(absolute) != absolute {
+		// Not the root directory, offer going up
+		listed = append(listed, listedEntry{name: "..", isDir: true})
+	}
+
+	for _, dirEntry := range dirEntries {
+		entry := listedEntry{name: dirEntry.Name(), isDir: dirEntry.IsDir()}
+
+		// Stat() rather than Info() to get the size of what symlinks point to
+		info, err := os.Stat(filepath.Join(dirname, dirEntry.Name()))
+		if err != nil {
+			log.Debug("Failed to stat ", dirEntry.Name(), ": ", err)
+			info, err = dirEntry.Info()
+		}
+		if err == nil {
+			entry.isDir = info.IsDir()
+			entry.modTime = info.ModTime().Format(_DirectoryTimeFormat)
+			if !entry.isDir {
+				entry.size = formatNumber(uint(info.Size()))
+			}
+		}
+
+		listed = append(listed, entry)
+	}
+
+	sort.SliceStable(listed, func(i, j int) bool {
+		if listed[i].name == ".." || listed[j].name == ".." {
+			return listed[i].name == ".."
+		}
+		return listed[i].isDir && !listed[j].isDir
+	})
+
+	sizeWidth := 0
+	for _, entry := range listed {
+		if len(entry.size) > sizeWidth {
+			sizeWidth = len(entry.size)
+		}
+	}
+
+	lines := make([]string, 0, len(listed))
+	entries := make([]string, 0, len(listed))
+	for _, entry := range listed {
+		name := escapeControlCharacters(entry.name)
+		if entry.isDir {
+			// Bold with a trailing slash, like "ls -F" with colors
+			name = "\x1b[1m" + name + "/\x1b[m"
+		}
+
+		lines = append(lines, fmt.Sprintf("%*s  %-*s  %s",
+			sizeWidth, entry.size,
+			len(_DirectoryTimeFormat), entry.modTime,
+			name))
+		entries = append(entries, entry.name)
+	}
+
+	return lines, entries, nil
+}
+
+// File names can contain escape sequences and other control characters. Show
+// those as octal escapes like "ls -b" does, rather than letting the terminal
+// act on them.
+func escapeControlCharacters(name string) string {
+	escaped := strings.Builder{}
+	for _, char := range name {
+		if unicode.IsControl(char) {
+			escaped.WriteString(fmt.Sprintf("\\%03o", char))
+			continue
+		}
+		escaped.WriteRune(char)
+	}
+	return escaped.String()
+}
+
+// Open the entry under the cursor in a nested view
+func (p *Pager) openDirectoryEntry() {
+	directory := p.reader.directory
+
+	// Entries are numbered before filtering, and separators are 0
+	selected := p.reader.unfilteredLineNumber(p.cursorLineOneBased())
+	if selected < 1 || selected > len(directory.entries) {
+		return
+	}
+
+	path := filepath.Join(directory.path, directory.entries[selected-1])
+	opened, err := directory.open(path)
+	if err != nil {
+		p.message = err.Error()
+		return
+	}
+	p.own(opened)
+
+	p.parentViews = append(p.parentViews, _ParentView{
+		reader:                   p.reader,
+		scrollPosition:           p.scrollPosition,
+		leftColumnZeroBased:      p.leftColumnZeroBased,
+		targetLineNumberOneBased: p.TargetLineNumberOneBased,
+		cursor:                   p.cursorLineOneBased(),
+	})
+
+	p.reader = opened
+	p.scrollPosition = newScrollPosition("Pager scroll position")
+	p.leftColumnZeroBased = 0
+	p.TargetLineNumberOneBased = 0
+	p.cursor = 1
+	if p.screen != nil {
+		p.watchReader(opened)
+	}
+}
+
+// Go back from a nested view to where we opened it. Returns false if we
+// aren't in a nested view.
+func (p *Pager) closeNestedView() bool {
+	if len(p.parentViews) == 0 {
+		return false
+	}
+
+	p.endTailPreview()
+
+	parent := p.parentViews[len(p.parentViews)-1]
+	p.parentViews = p.parentViews[:len(p.parentViews)-1]
+
+	// Nothing will show the nested view again, it gets reopened if needed
+	p.releaseIfOwned(p.reader)
+
+	p.reader = parent.reader
+	p.scrollPosition = parent.scrollPosition
+	p.leftColumnZeroBased = parent.leftColumnZeroBased
+	p.TargetLineNumberOneBased = parent.targetLineNumberOneBased
+	p.cursor = parent.cursor
+
+	return true
+}
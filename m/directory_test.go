@@ -0,0 +1,106 @@
+package m
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func testDirectory(t *testing.T) string {
+	dirname := t.TempDir()
+	assert.NilError(t, os.Mkdir(filepath.Join(dirname, "subdir"), 0o777))
+	assert.NilError(t, os.WriteFile(filepath.Join(dirname, "a.txt"), []byte("hello\n"), 0o666))
+	assert.NilError(t, os.WriteFile(filepath.Join(dirname, "b.txt"), []byte("there\n"), 0o666))
+	return dirname
+}
+
+func TestDirectoryListing(t *testing.T) {
+	dirname := testDirectory(t)
+	reader, err := NewReaderFromFilename(dirname, *styles.Get("native"), formatters.TTY16)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, reader.directory.entries, []string{"..", "subdir", "a.txt", "b.txt"})
+
+	lines := readLines(t, reader)
+	assert.Equal(t, len(lines), 4)
+	assert.Assert(t, strings.HasSuffix(lines[1], "  subdir/"), lines[1])
+	assert.Assert(t, strings.HasPrefix(lines[2], "6  "), lines[2])
+	assert.Assert(t, strings.HasSuffix(lines[2], "  a.txt"), lines[2])
+}
+
+func TestEscapeControlCharacters(t *testing.T) {
+	assert.Equal(t, escapeControlCharacters("plain åäö.txt"), "plain åäö.txt")
+	assert.Equal(t, escapeControlCharacters("\x1b]0;title\a.txt"), "\\033]0;title\\007.txt")
+	assert.Equal(t, escapeControlCharacters("c1\u009b.txt"), "c1\\233.txt")
+}
+
+func TestDirectoryNavigation(t *testing.T) {
+	dirname := testDirectory(t)
+	listing, err := NewReaderFromDirectory(dirname, *styles.Get("native"), formatters.TTY16)
+	assert.NilError(t, err)
+
+	pager := NewPager(listing)
+	screen := twin.NewFakeScreen(80, 10)
+	pager.screen = screen
+	pager.redraw("")
+	assert.Equal(t, pager.cursorLineOneBased(), 1)
+
+	// Down to b.txt, the cursor moves but the listing doesn't
+	pager.onRune('j')
+	pager.onKey(twin.KeyDown)
+	pager.onRune('j')
+	pager.redraw("")
+	assert.Equal(t, pager.cursorLineOneBased(), 4)
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	assert.Equal(t, screen.GetRow(3)[79].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+	assert.Equal(t, screen.GetRow(2)[79].Style, twin.StyleDefault)
+
+	pager.onKey(twin.KeyEnter)
+	assert.Assert(t, pager.reader != listing)
+	assert.DeepEqual(t, readLines(t, pager.reader), []string{"there"})
+
+	// Quitting goes back to the listing, with the cursor where it was
+	pager.onRune('q')
+	assert.Equal(t, pager.quit, false)
+	assert.Assert(t, pager.reader == listing)
+	assert.Equal(t, pager.cursorLineOneBased(), 4)
+
+	// Subdirectories open as listings of their own
+	pager.onRune('k')
+	pager.onRune('k')
+	pager.onKey(twin.KeyEnter)
+	assert.Assert(t, pager.reader.directory != nil)
+	assert.Equal(t, pager.reader.directory.path, filepath.Join(dirname, "subdir"))
+	pager.onKey(twin.KeyEscape)
+	assert.Assert(t, pager.reader == listing)
+
+	pager.onRune('q')
+	assert.Equal(t, pager.quit, true)
+}
+
+func TestOpenFilteredDirectoryEntry(t *testing.T) {
+	dirname := testDirectory(t)
+	listing, err := NewReaderFromDirectory(dirname, *styles.Get("native"), formatters.TTY16)
+	assert.NilError(t, err)
+
+	pager := NewPager(listing)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+
+	typeFilter(pager, "b.txt")
+	assert.Equal(t, listing.GetLineCount(), 1)
+	pager.redraw("")
+
+	pager.onKey(twin.KeyEnter)
+	assert.DeepEqual(t, readLines(t, pager.reader), []string{"there"})
+
+	pager.onRune('q')
+	assert.Assert(t, pager.reader == listing)
+	assert.Equal(t, pager.cursorLineOneBased(), 1)
+}
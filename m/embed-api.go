@@ -1,22 +1,126 @@
 package m
 
 import (
+	"context"
+
 	"github.com/walles/moar/twin"
 )
 
+// Tells the main loop to run the calls made using post()
+type eventCallsPosted struct{}
+
 // Page displays text in a pager.
 func (p *Pager) Page() error {
+	return p.PageContext(context.Background())
+}
+
+// PageContext displays text in a pager until either the user quits or the
+// context is done.
+//
+// If the context is done before the user quits, the context's error is
+// returned.
+func (p *Pager) PageContext(ctx context.Context) error {
 	screen, e := twin.NewScreen()
 	if e != nil {
 		// Screen setup failed
 		return e
 	}
 
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.post(func(p *Pager) {
+				p.quit = true
+			})
+		case <-stopped:
+		}
+	}()
+
 	p.StartPaging(screen, nil, nil)
+	close(stopped)
 	screen.Close()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if p.DeInit {
 		return nil
 	}
 
 	return p.ReprintAfterExit()
 }
+
+// GoToLine scrolls the pager so that this line is at the top of the screen.
+// If the line hasn't been read yet, the pager scrolls there once it has.
+//
+// Can be called from any goroutine, also before paging has started.
+func (p *Pager) GoToLine(lineNumberOneBased int) {
+	p.post(func(p *Pager) {
+		p.pushJump()
+		p.scrollPosition = NewScrollPositionFromLineNumberOneBased(lineNumberOneBased, "GoToLine")
+		p.TargetLineNumberOneBased = 0
+		if lineNumberOneBased > p.reader.GetLineCount() {
+			// Get there when we can
+			p.TargetLineNumberOneBased = lineNumberOneBased
+		}
+	})
+}
+
+// Search highlights all matches of a pattern, and scrolls to the first one
+// unless there already is one on screen. Just like when the user searches,
+// the pattern is a regexp if it is a valid one, and it's case sensitive only
+// if it contains upper case characters.
+//
+// Can be called from any goroutine, also before paging has started.
+func (p *Pager) Search(pattern string) {
+	p.post(func(p *Pager) {
+		p.pushJump()
+		p.searchString = pattern
+		p.updateSearchPattern()
+		p.TargetLineNumberOneBased = 0
+	})
+}
+
+// Run some call on the main loop's goroutine, where it's safe to touch the
+// pager state.
+//
+// Calls posted before paging starts are run when it does.
+func (p *Pager) post(call func(p *Pager)) {
+	p.pendingCallsLock.Lock()
+	p.pendingCalls = append(p.pendingCalls, call)
+	p.pendingCallsLock.Unlock()
+
+	// Non-blocking, if the main loop already has a notification pending it
+	// will run this call as well
+	select {
+	case p.callsPosted <- true:
+	default:
+	}
+}
+
+func (p *Pager) runPendingCalls() {
+	p.pendingCallsLock.Lock()
+	calls := p.pendingCalls
+	p.pendingCalls = nil
+	p.pendingCallsLock.Unlock()
+
+	for _, call := range calls {
+		call(p)
+	}
+}
+
+// Tell OnScroll about where we are, if it changed since last time
+func (p *Pager) reportScroll() {
+	if p.OnScroll == nil {
+		return
+	}
+
+	lineNumber := p.lineNumberOneBased()
+	if lineNumber == p.reportedLineNumberOneBased {
+		return
+	}
+
+	p.reportedLineNumberOneBased = lineNumber
+	p.OnScroll(p, lineNumber)
+}
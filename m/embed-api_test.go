@@ -0,0 +1,143 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func numberedReader(count int) *Reader {
+	lines := []string{}
+	for i := 1; i <= count; i++ {
+		lines = append(lines, fmt.Sprint("line ", i))
+	}
+	return NewReaderFromText("numbers", strings.Join(lines, "\n"))
+}
+
+func TestCallsBeforePaging(t *testing.T) {
+	pager := NewPager(numberedReader(100))
+	pager.GoToLine(50)
+	pager.Search("line 7")
+
+	quitCalled := false
+	pager.OnQuit = func(p *Pager) {
+		quitCalled = true
+	}
+
+	pager.Quit()
+	pager.StartPaging(twin.NewFakeScreen(20, 10), nil, nil)
+
+	assert.Equal(t, pager.lineNumberOneBased(), 70)
+	assert.Equal(t, pager.searchString, "line 7")
+	assert.Assert(t, pager.searchPattern.MatchString("LINE 7"))
+	assert.Equal(t, quitCalled, true)
+}
+
+// Calls posted after paging are left for the next time we page
+func TestCallsAfterPaging(t *testing.T) {
+	pager := NewPager(numberedReader(100))
+	pager.Quit()
+	pager.StartPaging(twin.NewFakeScreen(20, 10), nil, nil)
+
+	// Nobody should be listening any more
+	pager.GoToLine(50)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, len(pager.callsPosted), 1)
+
+	pager.quit = false
+	pager.Quit()
+	pager.StartPaging(twin.NewFakeScreen(20, 10), nil, nil)
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+}
+
+// Readers we were given could be paged again, so only ours get released
+func TestReleaseOwnedReaders(t *testing.T) {
+	given := numberedReader(10)
+	pager := NewPager(given)
+	owned := NewReaderFromText("owned", "owned")
+	pager.own(owned)
+
+	pager.Quit()
+	pager.StartPaging(twin.NewFakeScreen(20, 10), nil, nil)
+	assert.Assert(t, !given.released.Load())
+	assert.Assert(t, owned.released.Load())
+
+	pager.quit = false
+	pager.ReleaseReaders = true
+	pager.Quit()
+	pager.StartPaging(twin.NewFakeScreen(20, 10), nil, nil)
+	assert.Assert(t, given.released.Load())
+}
+
+func TestGoToUnreadLine(t *testing.T) {
+	pager := NewPager(numberedReader(10))
+	pager.GoToLine(500)
+	pager.runPendingCalls()
+
+	// Once there are enough lines, the main loop will scroll there
+	assert.Equal(t, pager.TargetLineNumberOneBased, 500)
+}
+
+func TestCustomKeyHandlers(t *testing.T) {
+	pager := NewPager(numberedReader(100))
+	pager.screen = twin.NewFakeScreen(20, 10)
+
+	handledRunes := []rune{}
+	pager.RuneHandler = func(p *Pager, char rune) bool {
+		if char != 'q' {
+			return false
+		}
+		handledRunes = append(handledRunes, char)
+		return true
+	}
+	pager.KeyHandler = func(p *Pager, key twin.KeyCode) bool {
+		p.GoToLine(42)
+		return true
+	}
+
+	pager.onRune('q')
+	assert.Equal(t, pager.quit, false)
+	assert.DeepEqual(t, handledRunes, []rune{'q'})
+
+	// Unhandled runes still work
+	pager.redraw("")
+	pager.onRune('j')
+	assert.Equal(t, pager.lineNumberOneBased(), 2)
+
+	pager.onKey(twin.KeyEscape)
+	assert.Equal(t, pager.quit, false)
+	pager.runPendingCalls()
+	assert.Equal(t, pager.lineNumberOneBased(), 42)
+}
+
+func TestStatusBarTextAndScrollReports(t *testing.T) {
+	pager := NewPager(numberedReader(100))
+	screen := twin.NewFakeScreen(40, 10)
+	pager.screen = screen
+
+	pager.StatusBarText = func(p *Pager, defaultText string) string {
+		return "Custom: " + strings.SplitN(defaultText, ":", 2)[0]
+	}
+	reported := []int{}
+	pager.OnScroll = func(p *Pager, firstVisibleLineOneBased int) {
+		reported = append(reported, firstVisibleLineOneBased)
+	}
+
+	pager.redraw("")
+	pager.reportScroll()
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(9))), "Custom: numbers")
+
+	pager.onRune('j')
+	pager.redraw("")
+	pager.reportScroll()
+
+	// Nothing moved, nothing to report
+	pager.redraw("")
+	pager.reportScroll()
+
+	assert.DeepEqual(t, reported, []int{1, 2})
+}
@@ -0,0 +1,230 @@
+package m
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// How much of the input to look at when guessing its encoding
+const _EncodingSniffLength = 64 * 1024
+
+var utf8Bom = []byte{0xef, 0xbb, 0xbf}
+var utf16LeBom = []byte{0xff, 0xfe}
+var utf16BeBom = []byte{0xfe, 0xff}
+
+// An input encoding other than plain UTF-8, which needs transcoding
+type inputEncoding struct {
+	// Shown in the status bar
+	name string
+
+	encoding encoding.Encoding
+
+	// True if ASCII characters, newlines in particular, are encoded as
+	// themselves. This means we can find line breaks without decoding.
+	asciiCompatible bool
+}
+
+// SetEncoding makes Readers created with these options decode their input
+// using the named encoding, rather than guessing what encoding the input has.
+//
+// The name can be any IANA name or alias, like "UTF-16LE", "windows-1252" or
+// "latin1". Pass an empty string to go back to guessing.
+func (options *ReaderOptions) SetEncoding(name string) error {
+	if name == "" {
+		options.encoding = nil
+		return nil
+	}
+
+	parsed, err := encodingFromName(name)
+	if err != nil {
+		return err
+	}
+
+	options.encoding = parsed
+	return nil
+}
+
+func encodingFromName(name string) (*inputEncoding, error) {
+	found, err := ianaindex.IANA.Encoding(name)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("encoding not supported: %s", name)
+	}
+
+	canonicalName, err := ianaindex.IANA.Name(found)
+	if err != nil {
+		canonicalName = name
+	}
+
+	if found == unicode.UTF8 {
+		// No transcoding needed, but do replace invalid bytes
+		return &inputEncoding{name: canonicalName, encoding: found, asciiCompatible: true}, nil
+	}
+
+	// UTF-16 variants are the only multi byte encodings we expect to see here
+	_, isCharmap := found.(*charmap.Charmap)
+	return &inputEncoding{
+		name:            canonicalName,
+		encoding:        found,
+		asciiCompatible: isCharmap,
+	}, nil
+}
+
+// Guess the encoding of some input based on its first bytes.
+//
+// Returns nil for plain UTF-8, which doesn't need any transcoding.
+func detectEncoding(header []byte) *inputEncoding {
+	if bytes.HasPrefix(header, utf8Bom) {
+		return &inputEncoding{name: "UTF-8 BOM", encoding: unicode.UTF8BOM, asciiCompatible: true}
+	}
+	if bytes.HasPrefix(header, utf16LeBom) {
+		return &inputEncoding{name: "UTF-16LE", encoding: unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)}
+	}
+	if bytes.HasPrefix(header, utf16BeBom) {
+		return &inputEncoding{name: "UTF-16BE", encoding: unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)}
+	}
+
+	// UTF-16 without a BOM, mostly ASCII text will have every other byte zero
+	zeroesAtEven := 0
+	zeroesAtOdd := 0
+	for i, b := range header {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			zeroesAtEven++
+		} else {
+			zeroesAtOdd++
+		}
+	}
+	pairCount := len(header) / 2
+	if pairCount >= 2 {
+		if zeroesAtOdd*10 > pairCount*4 && zeroesAtEven*10 < pairCount {
+			return &inputEncoding{name: "UTF-16LE", encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}
+		}
+		if zeroesAtEven*10 > pairCount*4 && zeroesAtOdd*10 < pairCount {
+			return &inputEncoding{name: "UTF-16BE", encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}
+		}
+	}
+
+	if looksLikeUtf8(header) {
+		return nil
+	}
+
+	// Not UTF-8, assume some legacy Western encoding. Windows-1252 is a
+	// superset of the printable part of Latin-1, so it works for both.
+	return &inputEncoding{name: "windows-1252", encoding: charmap.Windows1252, asciiCompatible: true}
+}
+
+// Valid UTF-8 looks like UTF-8. So does input with some broken characters, as
+// long as there are also some valid non-ASCII characters in there. Legacy 8 bit
+// encodings practically never produce valid multi byte UTF-8 characters.
+//
+// An incomplete character at the end is fine, since the header could end in
+// the middle of one.
+func looksLikeUtf8(header []byte) bool {
+	hasInvalid := false
+	hasMultiByte := false
+	for len(header) > 0 {
+		r, size := utf8.DecodeRune(header)
+		if r == utf8.RuneError && size <= 1 {
+			if !utf8.FullRune(header) {
+				// Incomplete character at the end
+				break
+			}
+			hasInvalid = true
+		} else if size > 1 {
+			hasMultiByte = true
+		}
+		header = header[size:]
+	}
+
+	return !hasInvalid || hasMultiByte
+}
+
+// Wait for the first bytes of a stream and return them, without consuming
+// them. We don't wait for more than whatever came in the first read, otherwise
+// slow pipes wouldn't show anything until we got the whole sniff length.
+func peekHeader(stream *bufio.Reader) ([]byte, error) {
+	_, err := stream.Peek(1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return stream.Peek(stream.Buffered())
+}
+
+// Returns a stream with the contents of the given stream transcoded into
+// UTF-8, plus the encoding it was transcoded from. The encoding is nil if the
+// stream was plain UTF-8 already.
+//
+// The header should be the first bytes of the stream, used for guessing its
+// encoding.
+func decodingReader(stream io.Reader, header []byte, options ReaderOptions) (io.Reader, *inputEncoding) {
+	detected := detectHeaderEncoding(header, options)
+	if detected == nil {
+		return stream, nil
+	}
+
+	log.Debug("Transcoding input from ", detected.name)
+	return transform.NewReader(stream, detected.encoding.NewDecoder()), detected
+}
+
+// Read the first bytes of a file, for guessing what it contains
+func readFileHeader(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Warn("Error closing file after reading its header: ", err)
+		}
+	}()
+
+	header := make([]byte, _EncodingSniffLength)
+	headerLength, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	return header[:headerLength], nil
+}
+
+// Figure out what encoding some input has, based on its first bytes
+func detectHeaderEncoding(header []byte, options ReaderOptions) *inputEncoding {
+	if options.encoding != nil {
+		return options.encoding
+	}
+
+	return detectEncoding(header)
+}
+
+// Transcode some bytes into an UTF-8 string
+func (e *inputEncoding) decode(encoded []byte) string {
+	if e == nil {
+		return string(encoded)
+	}
+
+	decoded, err := e.encoding.NewDecoder().Bytes(encoded)
+	if err != nil {
+		log.Debugf("Decoding %d bytes of %s failed: %s", len(encoded), e.name, err)
+		return string(encoded)
+	}
+
+	return string(decoded)
+}
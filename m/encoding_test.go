@@ -0,0 +1,88 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+func detectedEncodingName(header []byte) string {
+	detected := detectEncoding(header)
+	if detected == nil {
+		return ""
+	}
+	return detected.name
+}
+
+func TestDetectEncoding(t *testing.T) {
+	assert.Equal(t, detectedEncodingName([]byte("plain ASCII")), "")
+	assert.Equal(t, detectedEncodingName([]byte("UTF-8: ©")), "")
+	assert.Equal(t, detectedEncodingName([]byte("\xef\xbb\xbfUTF-8 with BOM")), "UTF-8 BOM")
+	assert.Equal(t, detectedEncodingName([]byte("\xff\xfea\x00b\x00")), "UTF-16LE")
+	assert.Equal(t, detectedEncodingName([]byte("\xfe\xff\x00a\x00b")), "UTF-16BE")
+	assert.Equal(t, detectedEncodingName([]byte("a\x00b\x00c\x00d\x00")), "UTF-16LE")
+	assert.Equal(t, detectedEncodingName([]byte("\x00a\x00b\x00c\x00d")), "UTF-16BE")
+	assert.Equal(t, detectedEncodingName([]byte("caf\xe9\n")), "windows-1252")
+
+	// Cut off in the middle of a "©"
+	assert.Equal(t, detectedEncodingName([]byte("UTF-8: \xc2")), "")
+
+	// Broken UTF-8 is still UTF-8
+	assert.Equal(t, detectedEncodingName([]byte("broken \xc2 but © valid")), "")
+}
+
+func readLines(t *testing.T, reader *Reader) []string {
+	assert.NilError(t, reader._wait())
+
+	lines := []string{}
+	for lineNumber := 1; lineNumber <= reader.GetLineCount(); lineNumber++ {
+		lines = append(lines, reader.GetLine(lineNumber).Plain(nil))
+	}
+	return lines
+}
+
+func TestUtf16File(t *testing.T) {
+	filename := t.TempDir() + "/utf16.txt"
+	utf16 := "\xff\xfeh\x00\xe4\x00j\x00\n\x00d\x00\xe5\x00\n\x00"
+	assert.NilError(t, os.WriteFile(filename, []byte(utf16), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, readLines(t, reader), []string{"häj", "då"})
+
+	lines, _ := reader.GetLines(1, 2)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "utf16.txt [UTF-16LE]: "), lines.statusText)
+}
+
+func TestLatin1Stream(t *testing.T) {
+	reader := NewReaderFromStream("latin1", strings.NewReader("caf\xe9\ncr\xe8me\n"))
+	assert.DeepEqual(t, readLines(t, reader), []string{"café", "crème"})
+
+	lines, _ := reader.GetLines(1, 2)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "latin1 [windows-1252]: "), lines.statusText)
+}
+
+func TestUtf8StatusHasNoEncoding(t *testing.T) {
+	reader := NewReaderFromStream("utf8", strings.NewReader("café\n"))
+	assert.DeepEqual(t, readLines(t, reader), []string{"café"})
+
+	lines, _ := reader.GetLines(1, 1)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "utf8: "), lines.statusText)
+}
+
+func TestFileBackedLatin1(t *testing.T) {
+	filename := t.TempDir() + "/latin1.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("caf\xe9\ncr\xe8me"), 0o600))
+
+	header, err := readFileHeader(filename)
+	assert.NilError(t, err)
+	detected := detectHeaderEncoding(header, ReaderOptions{})
+
+	reader, err := newFileBackedReader(filename, detected)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, readLines(t, reader), []string{"café", "crème"})
+}
@@ -0,0 +1,83 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Longer error summaries are cut off in the status bar
+const _ErrorSummaryMaxLength = 60
+
+// Describe any problems reading the input of this Reader.
+//
+// The summary is a one-liner for the status bar, and the details are the full
+// error text. Both are empty if there were no problems.
+func (r *Reader) problems() (summary string, details string) {
+	r.Lock()
+	defer r.Unlock()
+
+	detailsParts := []string{}
+	if r.err != nil {
+		summary = r.err.Error()
+		detailsParts = append(detailsParts, "Error: "+r.err.Error())
+	}
+
+	// Filter error messages are often part of the error already
+	if r.stderrText != "" && (r.err == nil || !strings.Contains(r.err.Error(), r.stderrText)) {
+		if summary == "" {
+			summary = "Filter said: " + r.stderrText
+		}
+		detailsParts = append(detailsParts, "Filter output on stderr:\n"+r.stderrText)
+	}
+
+	if summary == "" {
+		return "", ""
+	}
+
+	summary, _, _ = strings.Cut(summary, "\n")
+	summaryRunes := []rune(summary)
+	if len(summaryRunes) > _ErrorSummaryMaxLength {
+		summary = string(summaryRunes[:_ErrorSummaryMaxLength-1]) + "…"
+	}
+
+	return summary, strings.Join(detailsParts, "\n\n")
+}
+
+// Status bar text telling the user about problems with the current Reader
+func (p *Pager) errorStatus() string {
+	if p.isShowingHelp {
+		return ""
+	}
+
+	summary, _ := p.reader.problems()
+	if summary == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("  ERROR: %s, press 'E' for details", summary)
+}
+
+// Show the full text of any problems with the current Reader, in a buffer of
+// its own. Leave it like the help screen, using 'q' or ESC.
+func (p *Pager) showErrors() {
+	if p.isShowingHelp {
+		return
+	}
+
+	_, details := p.reader.problems()
+	if details == "" {
+		log.Debug("No errors to show")
+		return
+	}
+
+	name := "Errors"
+	p.reader.Lock()
+	if p.reader.name != nil {
+		name = *p.reader.name + " errors"
+	}
+	p.reader.Unlock()
+
+	p.showOverlay(NewReaderFromText(name, details))
+}
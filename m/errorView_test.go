@@ -0,0 +1,57 @@
+package m
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestFilterProblems(t *testing.T) {
+	reader, err := newReaderFromCommand("input", "sh", "-c", "echo out; echo oops >&2; exit 3")
+	assert.NilError(t, err)
+	assert.Assert(t, reader._wait() != nil)
+
+	summary, details := reader.problems()
+	assert.Equal(t, summary, "oops: exit status 3")
+	assert.Equal(t, details, "Error: oops: exit status 3")
+}
+
+func TestFilterStderrWithoutError(t *testing.T) {
+	reader, err := newReaderFromCommand("input", "sh", "-c", "echo out; echo warning >&2")
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	summary, details := reader.problems()
+	assert.Equal(t, summary, "Filter said: warning")
+	assert.Equal(t, details, "Filter output on stderr:\nwarning")
+}
+
+func TestNoProblems(t *testing.T) {
+	summary, details := NewReaderFromText("fine", "all good").problems()
+	assert.Equal(t, summary, "")
+	assert.Equal(t, details, "")
+}
+
+func TestShowErrors(t *testing.T) {
+	reader := NewReaderFromText("broken", "partial contents")
+	reader.err = errors.New("error reading line from input stream: unexpected EOF\nmore details")
+
+	pager := NewPager(reader)
+	screen := twin.NewFakeScreen(200, 10)
+	pager.screen = screen
+	pager.redraw("")
+	statusBar := rowToString(screen.GetRow(9))
+	assert.Assert(t, strings.Contains(statusBar, "ERROR: error reading line from input stream: unexpected EOF, press 'E'"), statusBar)
+
+	pager.onRune('E')
+	assert.Assert(t, pager.reader != reader)
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "Error: error reading line from input stream: unexpected EOF")
+	assert.Equal(t, pager.reader.GetLine(2).Plain(nil), "more details")
+
+	pager.onRune('q')
+	assert.Assert(t, pager.reader == reader)
+	assert.Equal(t, pager.quit, false)
+}
@@ -0,0 +1,288 @@
+package m
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Files larger than this won't be kept in memory. Instead we keep only the
+// offset of each line, and read the lines from disk when they are requested.
+const MAX_IN_MEMORY_SIZE int64 = 128 * 1024 * 1024
+
+// How many decoded lines to keep around for file backed readers
+const _LineCacheSize = 10_000
+
+// fileBackedLines keeps track of where in a file each line starts, and reads
+// lines from that file on demand.
+//
+// All methods expect the owning Reader to be locked.
+type fileBackedLines struct {
+	file *os.File
+
+	// Byte offsets of where each line starts
+	lineStarts []int64
+
+	// Byte offset of the end of the last line in lineStarts
+	end int64
+
+	cache *lineCache
+
+	// What the file is encoded in, nil means UTF-8
+	encoding *inputEncoding
+
+	// Set by highlightIncrementally() if we know how to highlight the file.
+	// Lines are highlighted in chunks as they are shown, and then kept in
+	// highlightedCache.
+	lexer            chroma.Lexer
+	style            chroma.Style
+	formatter        chroma.Formatter
+	highlightedCache *lineCache
+}
+
+// lineCache is a least-recently-used cache of decoded lines
+type lineCache struct {
+	maxSize int
+
+	// Most recently used entry first, values are *lineCacheEntry
+	order   *list.List
+	entries map[int]*list.Element
+}
+
+type lineCacheEntry struct {
+	index int
+	line  *Line
+}
+
+func newLineCache(maxSize int) *lineCache {
+	return &lineCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[int]*list.Element),
+	}
+}
+
+func (c *lineCache) get(index int) *Line {
+	element, found := c.entries[index]
+	if !found {
+		return nil
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*lineCacheEntry).line
+}
+
+func (c *lineCache) put(index int, line *Line) {
+	if element, found := c.entries[index]; found {
+		element.Value.(*lineCacheEntry).line = line
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[index] = c.order.PushFront(&lineCacheEntry{index: index, line: line})
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lineCacheEntry).index)
+	}
+}
+
+func newFileBackedLines(file *os.File, encoding *inputEncoding) *fileBackedLines {
+	return &fileBackedLines{
+		file:             file,
+		cache:            newLineCache(_LineCacheSize),
+		encoding:         encoding,
+		highlightedCache: newLineCache(_LineCacheSize),
+	}
+}
+
+func (f *fileBackedLines) count() int {
+	return len(f.lineStarts)
+}
+
+// Get a line by its zero-based index, highlighted if it has been shown
+func (f *fileBackedLines) get(index int) *Line {
+	if highlighted := f.highlightedCache.get(index); highlighted != nil {
+		return highlighted
+	}
+
+	return f.getPlain(index)
+}
+
+// Get a line by its zero-based index, reading it from disk if it isn't cached
+func (f *fileBackedLines) getPlain(index int) *Line {
+	if cached := f.cache.get(index); cached != nil {
+		return cached
+	}
+
+	start := f.lineStarts[index]
+	end := f.end
+	if index+1 < len(f.lineStarts) {
+		end = f.lineStarts[index+1]
+	}
+
+	buffer := make([]byte, end-start)
+	_, err := f.file.ReadAt(buffer, start)
+	if err != nil && err != io.EOF {
+		log.Warnf("Reading line %d at offset %d failed: %s", index+1, start, err)
+		line := NewLine("")
+		return &line
+	}
+
+	buffer = bytes.TrimSuffix(buffer, []byte{'\n'})
+	buffer = bytes.TrimSuffix(buffer, []byte{'\r'})
+
+	line := NewLine(f.encoding.decode(buffer))
+	f.cache.put(index, &line)
+	return &line
+}
+
+// Highlight the chunk of lines around some zero-based line index, unless we
+// already have
+func (f *fileBackedLines) highlight(index int) {
+	if f.lexer == nil || index < 0 || index >= f.count() {
+		return
+	}
+	if f.highlightedCache.get(index) != nil {
+		return
+	}
+
+	firstIndex := index / _HighlightChunkSize * _HighlightChunkSize
+	lastIndex := firstIndex + _HighlightChunkSize
+	if lastIndex > f.count() {
+		lastIndex = f.count()
+	}
+
+	contextFirst, contextLast := highlightContext(firstIndex, lastIndex, f.count())
+	contextLines := make([]*Line, 0, contextLast-contextFirst)
+	for lineIndex := contextFirst; lineIndex < contextLast; lineIndex++ {
+		contextLines = append(contextLines, f.getPlain(lineIndex))
+	}
+	plainLines := contextLines[firstIndex-contextFirst : lastIndex-contextFirst]
+
+	highlightedLines := highlightLines(contextLines, firstIndex-contextFirst, lastIndex-contextFirst, f.lexer, f.style, f.formatter)
+	if highlightedLines == nil {
+		// Keep the plain lines, so that we don't try this chunk again
+		highlightedLines = plainLines
+	}
+	for i, line := range highlightedLines {
+		f.highlightedCache.put(firstIndex+i, line)
+	}
+}
+
+// Highlight any file backed lines about to be shown. Unlike other lines, those
+// aren't highlighted in the background.
+func (r *Reader) highlightFileLinesUnlocked(firstLineZeroBased int, lastLineZeroBased int) {
+	if r.fileLines == nil || r.showingHex || r.json != nil || r.logView != nil {
+		return
+	}
+
+	for lineIndex := firstLineZeroBased; lineIndex <= lastLineZeroBased; lineIndex++ {
+		inputIndex := lineIndex
+		if r.filter != nil {
+			inputIndex = r.filter.lines[lineIndex].index
+		}
+		r.fileLines.highlight(inputIndex)
+	}
+}
+
+// Find where all lines in the file start, in the background. Lines can be
+// requested while this is running.
+func (reader *Reader) indexFile(file *os.File) {
+	defer reader.cleanupFilter(nil)
+
+	t0 := time.Now().UnixNano()
+	buffer := make([]byte, 1024*1024)
+	var offset int64
+	var lineStart int64
+	newLineStarts := make([]int64, 0, 1024)
+	for {
+		readCount, err := file.ReadAt(buffer, offset)
+
+		newLineStarts = newLineStarts[:0]
+		chunk := buffer[:readCount]
+		chunkStart := offset
+		for {
+			newlineIndex := bytes.IndexByte(chunk, '\n')
+			if newlineIndex < 0 {
+				break
+			}
+
+			newLineStarts = append(newLineStarts, lineStart)
+			lineStart = chunkStart + int64(newlineIndex) + 1
+			chunkStart = lineStart
+			chunk = chunk[newlineIndex+1:]
+		}
+		offset += int64(readCount)
+
+		reader.Lock()
+		if reader.replaced || reader.released.Load() {
+			// Somebody called setText() or release(), never mind indexing the
+			// rest of this file
+			reader.Unlock()
+			return
+		}
+		reader.fileLines.lineStarts = append(reader.fileLines.lineStarts, newLineStarts...)
+		reader.fileLines.end = lineStart
+		if err == io.EOF && lineStart < offset {
+			// Last line has no trailing newline
+			reader.fileLines.lineStarts = append(reader.fileLines.lineStarts, lineStart)
+			reader.fileLines.end = offset
+		}
+		reader.signalInputChangedUnlocked()
+		reader.Unlock()
+
+		select {
+		case reader.moreLinesAdded <- true:
+		default:
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			reader.Lock()
+			if reader.err == nil {
+				reader.err = fmt.Errorf("error indexing file: %w", err)
+			}
+			reader.Unlock()
+			break
+		}
+	}
+
+	t1 := time.Now().UnixNano()
+	dtNanos := t1 - t0
+	log.Debug("File indexed in ", dtNanos/1_000_000, "ms")
+}
+
+// newFileBackedReader creates a Reader that doesn't keep the file contents in
+// memory, but reads lines from disk as they are requested. Use this for files
+// that are too large to fit in memory.
+//
+// The encoding must be nil (for UTF-8) or ASCII compatible, since we find
+// lines by looking for newline bytes.
+func newFileBackedReader(filename string, encoding *inputEncoding) (*Reader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newReader()
+	reader.highlightingDone.Store(true) // Until somebody starts highlightIncrementally()
+	reader.name = &filename
+	if encoding == nil {
+		reader.seekableFilename = &filename
+	}
+	reader.encoding = encoding
+	reader.fileLines = newFileBackedLines(file, encoding)
+
+	go reader.indexFile(file)
+
+	return reader, nil
+}
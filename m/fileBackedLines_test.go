@@ -0,0 +1,97 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// File backed readers should give us the same lines as in-memory readers do
+func TestFileBackedReaderSamples(t *testing.T) {
+	for _, filename := range getTestFiles() {
+		if strings.Contains(filename, "compressed") {
+			// File backed readers don't decompress
+			continue
+		}
+
+		t.Run(filename, func(t *testing.T) {
+			file, err := os.Open(filename)
+			assert.NilError(t, err)
+			defer func() {
+				assert.NilError(t, file.Close())
+			}()
+
+			inMemory := NewReaderFromStream(filename, file)
+			assert.NilError(t, inMemory._wait())
+
+			fileBacked, err := newFileBackedReader(filename, nil)
+			assert.NilError(t, err)
+			assert.NilError(t, fileBacked._wait())
+
+			assert.Equal(t, fileBacked.GetLineCount(), inMemory.GetLineCount())
+			for lineNumber := 1; lineNumber <= inMemory.GetLineCount(); lineNumber++ {
+				assert.Equal(t,
+					fileBacked.GetLine(lineNumber).Plain(nil),
+					inMemory.GetLine(lineNumber).Plain(nil),
+					"Line %d", lineNumber)
+			}
+		})
+	}
+}
+
+func TestFileBackedReaderGetLines(t *testing.T) {
+	filename := t.TempDir() + "/lines.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("a\nb\r\nc\n\nlast"), 0o600))
+
+	reader, err := newFileBackedReader(filename, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	lines, overflow := reader.GetLines(2, 10)
+	assert.Equal(t, overflow, didFit)
+	assert.Equal(t, lines.firstLineOneBased, 1)
+	assert.Equal(t, len(lines.lines), 5)
+
+	plains := []string{}
+	for _, line := range lines.lines {
+		plains = append(plains, line.Plain(nil))
+	}
+	assert.DeepEqual(t, plains, []string{"a", "b", "c", "", "last"})
+}
+
+func TestFileBackedReaderRelease(t *testing.T) {
+	filename := t.TempDir() + "/lines.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("a\nb\n"), 0o600))
+
+	reader, err := newFileBackedReader(filename, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	reader.release()
+	_, err = reader.fileLines.file.Stat()
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	// Releasing twice should be fine
+	reader.release()
+}
+
+func TestLineCacheEviction(t *testing.T) {
+	cache := newLineCache(2)
+	one := NewLine("one")
+	two := NewLine("two")
+	three := NewLine("three")
+
+	cache.put(1, &one)
+	cache.put(2, &two)
+
+	// Touch 1 so that 2 becomes the least recently used entry
+	assert.Equal(t, cache.get(1), &one)
+
+	cache.put(3, &three)
+	assert.Equal(t, len(cache.entries), 2)
+	assert.Assert(t, cache.get(2) == nil)
+	assert.Equal(t, cache.get(1), &one)
+	assert.Equal(t, cache.get(3), &three)
+}
@@ -0,0 +1,125 @@
+package m
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// Where we were in a file, so that we can get back there after switching to
+// some other file and back again.
+type _FileState struct {
+	scrollPosition           scrollPosition
+	leftColumnZeroBased      int
+	targetLineNumberOneBased int
+}
+
+// AddReader adds another file to page through. Switch between files using :n
+// and :p.
+//
+// Must be called before StartPaging().
+func (p *Pager) AddReader(r *Reader) {
+	if p.reader == nil {
+		p.reader = r
+	}
+
+	p.readers = append(p.readers, r)
+	p.fileStates = append(p.fileStates, nil)
+}
+
+// Switch to the file at the given (zero-based) index. Our position in the file
+// we're switching away from is remembered.
+func (p *Pager) switchToFile(index int) {
+	if index < 0 || index >= len(p.readers) {
+		log.Debugf("Not switching to out of bounds file index %d, have %d files", index, len(p.readers))
+		return
+	}
+
+	if p.isShowingHelp {
+		// Switching files while showing help would mess up our pre-help state
+		return
+	}
+
+	if len(p.parentViews) > 0 {
+		// We're in something opened from a directory listing, not in any of
+		// our files
+		return
+	}
+
+	p.endTailPreview()
+	p.fileStates[p.currentFileIndex] = &_FileState{
+		scrollPosition:           p.scrollPosition,
+		leftColumnZeroBased:      p.leftColumnZeroBased,
+		targetLineNumberOneBased: p.TargetLineNumberOneBased,
+	}
+
+	p.currentFileIndex = index
+	p.reader = p.readers[index]
+	if p.screen != nil {
+		p.watchReader(p.reader)
+	}
+
+	state := p.fileStates[index]
+	if state == nil {
+		// First visit to this file, start at the top
+		p.scrollPosition = newScrollPosition("Pager scroll position")
+		p.leftColumnZeroBased = 0
+		p.TargetLineNumberOneBased = 0
+		return
+	}
+
+	p.scrollPosition = state.scrollPosition
+	p.leftColumnZeroBased = state.leftColumnZeroBased
+	p.TargetLineNumberOneBased = state.targetLineNumberOneBased
+}
+
+// Returns something like "  file 2/7" if we're paging more than one file, or an
+// empty string otherwise.
+func (p *Pager) fileNumberStatus() string {
+	if len(p.readers) <= 1 || p.isShowingHelp {
+		return ""
+	}
+
+	return fmt.Sprintf("  file %d/%d", p.currentFileIndex+1, len(p.readers))
+}
+
+func (p *Pager) addColonCommandFooter() {
+	_, height := p.screen.Size()
+
+	pos := 0
+	for _, token := range ":" {
+		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault))
+		pos++
+	}
+
+	// Add a cursor
+	p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
+}
+
+func (p *Pager) onColonCommandKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	default:
+		log.Tracef("Unhandled colon command key event %v, treating as a viewing key event", key)
+		p.mode = _Viewing
+		p.onKey(key)
+	}
+}
+
+func (p *Pager) onColonCommandRune(char rune) {
+	p.mode = _Viewing
+
+	switch char {
+	case 'n':
+		p.switchToFile(p.currentFileIndex + 1)
+
+	case 'p':
+		p.switchToFile(p.currentFileIndex - 1)
+
+	default:
+		log.Debugf("Unhandled colon command rune '%s'/0x%08x", string(char), int32(char))
+	}
+}
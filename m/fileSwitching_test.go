@@ -0,0 +1,48 @@
+package m
+
+import (
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestSwitchFiles(t *testing.T) {
+	first := NewReaderFromText("first", "a\nb\nc\nd\ne\nf")
+	second := NewReaderFromText("second", "1\n2\n3\n4\n5\n6")
+
+	pager := NewPager(first)
+	pager.AddReader(second)
+	pager.ShowLineNumbers = false
+	pager.screen = twin.NewFakeScreen(20, 3)
+
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	// Scroll down a bit in the first file
+	pager.onRune('j')
+	assert.Equal(t, pager.lineNumberOneBased(), 2)
+
+	pager.onRune(':')
+	pager.onRune('n')
+	assert.Equal(t, pager.reader, second)
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	assert.Equal(t, pager.fileNumberStatus(), "  file 2/2")
+
+	// There is no next file, so this should be a no-op
+	pager.onRune(':')
+	pager.onRune('n')
+	assert.Equal(t, pager.reader, second)
+
+	pager.onRune(':')
+	pager.onRune('p')
+	assert.Equal(t, pager.reader, first)
+	assert.Equal(t, pager.fileNumberStatus(), "  file 1/2")
+
+	// We should be back where we left the first file
+	assert.Equal(t, pager.lineNumberOneBased(), 2)
+}
+
+func TestSingleFileHasNoFileNumberStatus(t *testing.T) {
+	pager := NewPager(NewReaderFromText("only", "a"))
+	assert.Equal(t, pager.fileNumberStatus(), "")
+}
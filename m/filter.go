@@ -0,0 +1,80 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+func (p *Pager) addFilterFooter() {
+	p.addPromptFooter(fmt.Sprintf("Filter (! to invert, UP / DOWN for context lines: %d): %s",
+		p.filterContext, p.filterString))
+}
+
+func (p *Pager) onFilterKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEnter:
+		p.mode = _Viewing
+		p.setFilter(p.filterString, p.filterContext)
+
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	case twin.KeyUp:
+		p.filterContext++
+
+	case twin.KeyDown:
+		if p.filterContext > 0 {
+			p.filterContext--
+		}
+
+	case twin.KeyBackspace, twin.KeyDelete:
+		if len(p.filterString) == 0 {
+			return
+		}
+
+		p.filterString = removeLastChar(p.filterString)
+
+	default:
+		log.Tracef("Unhandled filter key event %v", key)
+	}
+}
+
+func (p *Pager) onFilterRune(char rune) {
+	p.filterString += string(char)
+}
+
+// Show only lines matching a pattern, or only lines not matching it if the
+// filter starts with '!'. An empty filter shows all lines again.
+//
+// Context is the number of lines to show before and after each shown line,
+// like "grep -C".
+func (r *Reader) setFilter(filter string, context int) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.filterString = filter
+	r.filterPattern = toPattern(strings.TrimPrefix(filter, "!"))
+	r.filterInverted = strings.HasPrefix(filter, "!")
+	r.filterContext = context
+	if r.filterPattern == nil {
+		r.filterString = ""
+		r.filterContext = 0
+	}
+
+	r.updateFilterUnlocked()
+}
+
+// Filter the lines we show, staying at the same input line. See
+// Reader.setFilter().
+func (p *Pager) setFilter(filter string, context int) {
+	p.refilter(func() {
+		p.reader.setFilter(filter, context)
+	})
+
+	if filter != "" && p.reader.GetLineCount() == 0 && !p.reader.isFiltering() {
+		p.message = "No lines match: " + filter
+	}
+}
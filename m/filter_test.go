@@ -0,0 +1,156 @@
+package m
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func typeFilter(pager *Pager, filter string) {
+	pager.onRune('&')
+	for _, char := range filter {
+		pager.onRune(char)
+	}
+	pager.onKey(twin.KeyEnter)
+}
+
+func TestFilter(t *testing.T) {
+	reader := NewReaderFromText("fruits", "apple\nbanana\ncherry\napricot")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+
+	typeFilter(pager, "^a")
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.DeepEqual(t, readLines(t, reader), []string{"apple", "apricot"})
+
+	// Original line numbers in the gutter
+	assert.Equal(t, reader.displayLineNumber(2), 4)
+
+	lines, _ := reader.GetLines(1, 2)
+	assert.Assert(t, strings.HasSuffix(lines.statusText, "  &^a"), lines.statusText)
+
+	typeFilter(pager, "!an")
+	assert.DeepEqual(t, readLines(t, reader), []string{"apple", "cherry", "apricot"})
+
+	typeFilter(pager, "")
+	assert.DeepEqual(t, readLines(t, reader), []string{"apple", "banana", "cherry", "apricot"})
+	lines, _ = reader.GetLines(1, 4)
+	assert.Assert(t, !strings.Contains(lines.statusText, "&"), lines.statusText)
+}
+
+func TestFilterNoMatches(t *testing.T) {
+	pager := NewPager(NewReaderFromText("text", "one\ntwo"))
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+
+	typeFilter(pager, "three")
+	assert.Equal(t, pager.reader.GetLineCount(), 0)
+	assert.Equal(t, pager.message, "No lines match: three")
+}
+
+func TestClearingFilterKeepsPosition(t *testing.T) {
+	pager := NewPager(numberedReader(100))
+	pager.screen = twin.NewFakeScreen(80, 5)
+	pager.redraw("")
+
+	// Lines ending with 7, the third one of those is line 27
+	typeFilter(pager, "7$")
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(3, "test")
+	assert.Equal(t, pager.reader.displayLineNumber(pager.lineNumberOneBased()), 27)
+
+	typeFilter(pager, "")
+	assert.Equal(t, pager.lineNumberOneBased(), 27)
+}
+
+func TestFilterFollowedLines(t *testing.T) {
+	reader := NewWritableReader("")
+	reader.AppendLines("error: one", "fine")
+	reader.setFilter("error", 0)
+	assert.Equal(t, reader.GetLineCount(), 1)
+
+	reader.AppendLines("fine again", "error: two")
+	assert.Equal(t, reader.GetLineCount(), 2)
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "error: two")
+	assert.Equal(t, reader.displayLineNumber(2), 4)
+}
+
+func TestFilterContext(t *testing.T) {
+	reader := numberedReader(20)
+	pager := NewPager(reader)
+	screen := twin.NewFakeScreen(80, 10)
+	pager.screen = screen
+	pager.redraw("")
+
+	// Two more context lines
+	pager.onRune('&')
+	pager.onKey(twin.KeyUp)
+	pager.onKey(twin.KeyUp)
+	pager.onKey(twin.KeyDown)
+	for _, char := range "line 1[05]$" {
+		pager.onRune(char)
+	}
+	pager.onKey(twin.KeyEnter)
+
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		"line 9", "line 10", "line 11", "--", "line 14", "line 15", "line 16",
+	})
+
+	// Original line numbers in the gutter, and none for the separator
+	pager.redraw("")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(0))), "9 line 9")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(3))), "--")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(4))), "14 line 14")
+
+	// Context lines are dimmed, matches are highlighted
+	assert.Equal(t, screen.GetRow(0)[5].Style, twin.StyleDefault.WithAttr(twin.AttrDim))
+	assert.Equal(t, screen.GetRow(1)[5].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+
+	lines, _ := reader.GetLines(1, 7)
+	assert.Assert(t, strings.HasSuffix(lines.statusText, "  &line 1[05]$ -C1"), lines.statusText)
+}
+
+func TestFilterContextFollowedLines(t *testing.T) {
+	reader := NewWritableReader("")
+	reader.AppendLines("fine", "error: one")
+	reader.setFilter("error", 1)
+	assert.Equal(t, reader.GetLineCount(), 2)
+
+	reader.AppendLines("after", "fine", "fine", "error: two")
+	reader.Close()
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		"fine", "error: one", "after", "--", "fine", "error: two",
+	})
+	assert.Equal(t, reader.displayLineNumber(5), 5)
+}
+
+// Wait for the Reader to be done filtering in the background
+func waitForFilter(t *testing.T, reader *Reader) {
+	waitFor(t, "Filtering never finished", func() bool {
+		return !reader.isFiltering()
+	})
+}
+
+func TestFilterLargeInput(t *testing.T) {
+	reader := numberedReader(100 * _FilterChunkSize)
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(95000, "TestFilterLargeInput")
+
+	// Only some lines get checked right away, the rest in the background.
+	// Every tenth line matches.
+	typeFilter(pager, "0$")
+	assert.Assert(t, reader.GetLineCount() < 10*_FilterChunkSize)
+	assert.Equal(t, pager.message, "")
+
+	// We get to line 95000 once the background filtering has found it
+	assert.Equal(t, pager.pendingUnfilteredLineNumber, 95000)
+	waitForFilter(t, reader)
+	assert.Equal(t, reader.GetLineCount(), 10*_FilterChunkSize)
+	pager.scrollToUnfilteredLine(pager.pendingUnfilteredLineNumber)
+	assert.Equal(t, pager.pendingUnfilteredLineNumber, 0)
+	assert.Equal(t, reader.displayLineNumber(pager.lineNumberOneBased()), 95000)
+}
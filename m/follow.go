@@ -0,0 +1,336 @@
+package m
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How often to check followed files for new contents
+const _FollowPollInterval = 1 * time.Second
+
+// Read at most this much at a time from a followed file
+const _FollowChunkSize = 1024 * 1024
+
+// Keeps track of how far into a followed file we have read
+type _FileFollower struct {
+	reader   *Reader
+	filename string
+	file     *os.File
+
+	// Where the first byte not yet part of a complete line is
+	offset int64
+
+	// How far we have read, can be past offset if the last line is incomplete
+	readUpTo int64
+
+	// If true, the last line of the Reader has no trailing newline in the
+	// file, and will be replaced once we get the rest of it
+	lastLineIncomplete bool
+}
+
+// FollowByName makes the Reader keep reading its file after reaching the end,
+// just like "tail -F". If the file gets replaced (rotated) or truncated,
+// reading continues from the start of the new contents, and a marker line
+// saying what happened is added.
+//
+// This only works for uncompressed files read directly from disk. For other
+// Readers this method does nothing.
+func (reader *Reader) FollowByName() {
+	reader.Lock()
+	filename := reader.seekableFilename
+	reader.followingByName = filename != nil
+	reader.Unlock()
+
+	if filename == nil {
+		log.Debug("Not following Reader without a plain file to follow")
+		return
+	}
+
+	go reader.followFile(*filename, _FollowPollInterval)
+}
+
+func (reader *Reader) followFile(filename string, pollInterval time.Duration) {
+	// Wait for the initial read to finish, we want to continue from the end of
+	// it.
+	for !reader.done.Load() || !reader.highlightingDone.Load() {
+		if reader.released.Load() {
+			return
+		}
+		time.Sleep(pollInterval)
+	}
+
+	follower, err := newFileFollower(reader, filename)
+	if err != nil {
+		log.Warnf("Starting to follow %s failed: %s", filename, err)
+		return
+	}
+
+	follower.run(pollInterval)
+}
+
+// Must be called after the Reader is done with its initial read
+func newFileFollower(reader *Reader, filename string) (*_FileFollower, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	follower := &_FileFollower{
+		reader:   reader,
+		filename: filename,
+		file:     file,
+	}
+	err = follower.findStartOffset()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return follower, nil
+}
+
+func (f *_FileFollower) run(pollInterval time.Duration) {
+	log.Debugf("Following %s from byte offset %d", f.filename, f.offset)
+	for !f.reader.released.Load() {
+		f.poll()
+		time.Sleep(pollInterval)
+	}
+
+	log.Debugf("Done following %s", f.filename)
+	err := f.file.Close()
+	if err != nil {
+		log.Debugf("Closing followed file %s failed: %s", f.filename, err)
+	}
+}
+
+// Figure out where in the file the lines we already have end
+func (f *_FileFollower) findStartOffset() error {
+	f.reader.Lock()
+	// Not lineCountUnlocked(), JSON and filtering change that
+	lineCount := f.reader.inputLineCountUnlocked()
+	if f.reader.fileLines != nil && len(f.reader.lines) == 0 {
+		// File backed Readers know where their lines are
+		fileLines := f.reader.fileLines
+		f.offset = fileLines.end
+		if lineCount > 0 {
+			lastLineStart := fileLines.lineStarts[lineCount-1]
+			lastByte := make([]byte, 1)
+			_, err := f.file.ReadAt(lastByte, fileLines.end-1)
+			if err == nil && lastByte[0] != '\n' {
+				f.offset = lastLineStart
+				f.lastLineIncomplete = true
+			}
+		}
+		f.readUpTo = fileLines.end
+		f.reader.Unlock()
+		return nil
+	}
+	f.reader.Unlock()
+
+	// We don't know how many bytes our lines were, since they may have been
+	// highlighted. Count newlines in the file instead.
+	offset, newlineCount, fileSize, err := findLineEnd(f.file, lineCount)
+	if err != nil {
+		return err
+	}
+
+	f.offset = offset
+	f.readUpTo = offset
+	if newlineCount == lineCount {
+		return nil
+	}
+
+	if newlineCount == lineCount-1 && fileSize > offset {
+		// Our last line is still being written
+		f.readUpTo = fileSize
+		f.lastLineIncomplete = true
+		return nil
+	}
+
+	// The file has fewer lines than we do
+	f.restart(f.filename + " was truncated, following from the start")
+	return nil
+}
+
+// Find the byte offset after newline number lineCount. If there are fewer
+// newlines than that in the file, the offset after the last newline is
+// returned.
+//
+// Returns the offset, how many newlines were found and the size of the file.
+func findLineEnd(file *os.File, lineCount int) (int64, int, int64, error) {
+	buffer := make([]byte, 64*1024)
+	var position int64
+	var offset int64
+	newlineCount := 0
+	for newlineCount < lineCount {
+		readCount, err := file.ReadAt(buffer, position)
+
+		chunk := buffer[:readCount]
+		chunkStart := position
+		for newlineCount < lineCount {
+			newlineIndex := bytes.IndexByte(chunk, '\n')
+			if newlineIndex < 0 {
+				break
+			}
+			newlineCount++
+			offset = chunkStart + int64(newlineIndex) + 1
+			chunkStart = offset
+			chunk = chunk[newlineIndex+1:]
+		}
+		position += int64(readCount)
+
+		if err == io.EOF {
+			return offset, newlineCount, position, nil
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return offset, newlineCount, stat.Size(), nil
+}
+
+// Check the file for changes and read any new lines
+func (f *_FileFollower) poll() {
+	nameInfo, err := os.Stat(f.filename)
+	if err != nil {
+		// The file could be gone just for a moment while being rotated, check
+		// again later
+		log.Tracef("Followed file %s not found: %s", f.filename, err)
+		return
+	}
+
+	fileInfo, err := f.file.Stat()
+	if err != nil {
+		log.Debugf("Checking followed file %s failed: %s", f.filename, err)
+		return
+	}
+
+	if !os.SameFile(fileInfo, nameInfo) {
+		// Rotated. Get whatever was written to the old file before it was
+		// replaced, and then switch to the new one.
+		f.readNewLines(fileInfo.Size())
+
+		newFile, err := os.Open(f.filename)
+		if err != nil {
+			log.Debugf("Opening rotated file %s failed: %s", f.filename, err)
+			return
+		}
+		err = f.file.Close()
+		if err != nil {
+			log.Debugf("Closing rotated away file %s failed: %s", f.filename, err)
+		}
+		f.file = newFile
+		f.restart(f.filename + " was replaced, following the new file")
+
+		fileInfo, err = f.file.Stat()
+		if err != nil {
+			log.Debugf("Checking followed file %s failed: %s", f.filename, err)
+			return
+		}
+	}
+
+	if fileInfo.Size() < f.readUpTo {
+		// Copytruncate style log rotation
+		f.restart(f.filename + " was truncated, following from the start")
+	}
+
+	f.readNewLines(fileInfo.Size())
+}
+
+// Start over from the beginning of the file, and add a marker line telling the
+// user why
+func (f *_FileFollower) restart(message string) {
+	log.Debug(message)
+
+	marker := NewLine(_EofMarkerFormat + "--- " + message + " ---")
+
+	f.reader.Lock()
+	f.reader.lines = append(f.reader.lines, &marker)
+	f.reader.Unlock()
+
+	f.offset = 0
+	f.readUpTo = 0
+	f.lastLineIncomplete = false
+
+	select {
+	case f.reader.moreLinesAdded <- true:
+	default:
+	}
+}
+
+// Add any lines between our offset and the given file size to the Reader
+func (f *_FileFollower) readNewLines(fileSize int64) {
+	for f.readUpTo < fileSize {
+		end := f.readUpTo + _FollowChunkSize
+		if end > fileSize {
+			end = fileSize
+		}
+
+		buffer := make([]byte, end-f.offset)
+		readCount, err := f.file.ReadAt(buffer, f.offset)
+		if err != nil && err != io.EOF {
+			log.Debugf("Reading from followed file %s failed: %s", f.filename, err)
+			return
+		}
+		if readCount == 0 {
+			return
+		}
+		buffer = buffer[:readCount]
+
+		// The last part is either empty or an incomplete line
+		parts := strings.Split(string(buffer), "\n")
+		incomplete := parts[len(parts)-1]
+		newLines := make([]*Line, 0, len(parts))
+		for _, part := range parts[:len(parts)-1] {
+			line := NewLine(strings.TrimSuffix(part, "\r"))
+			newLines = append(newLines, &line)
+		}
+		if len(incomplete) > 0 {
+			line := NewLine(incomplete)
+			newLines = append(newLines, &line)
+		}
+
+		f.reader.Lock()
+		if f.lastLineIncomplete {
+			f.reader.removeLastLineUnlocked()
+		}
+		f.reader.lines = append(f.reader.lines, newLines...)
+		f.reader.Unlock()
+
+		f.readUpTo = f.offset + int64(readCount)
+		f.offset = f.readUpTo - int64(len(incomplete))
+		f.lastLineIncomplete = len(incomplete) > 0
+
+		select {
+		case f.reader.moreLinesAdded <- true:
+		default:
+		}
+	}
+}
+
+// Drop the last line, for replacing it with a more complete version
+func (reader *Reader) removeLastLineUnlocked() {
+	if len(reader.lines) > 0 {
+		reader.lines = reader.lines[:len(reader.lines)-1]
+		return
+	}
+
+	if reader.fileLines == nil || reader.fileLines.count() == 0 {
+		return
+	}
+
+	// The line will come back, after the file backed lines
+	fileLines := reader.fileLines
+	fileLines.end = fileLines.lineStarts[len(fileLines.lineStarts)-1]
+	fileLines.lineStarts = fileLines.lineStarts[:len(fileLines.lineStarts)-1]
+}
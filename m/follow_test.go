@@ -0,0 +1,151 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+func appendToFile(t *testing.T, filename string, text string) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0o600)
+	assert.NilError(t, err)
+	_, err = file.WriteString(text)
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+}
+
+// Wait for the reader to have the given plain text lines, fail the test if
+// that doesn't happen within a few seconds
+func waitForLines(t *testing.T, reader *Reader, expected ...string) {
+	var actual []string
+	eventually(func() bool {
+		actual = []string{}
+		for lineNumber := 1; lineNumber <= reader.GetLineCount(); lineNumber++ {
+			actual = append(actual, reader.GetLine(lineNumber).Plain(nil))
+		}
+		return strings.Join(actual, "\n") == strings.Join(expected, "\n")
+	})
+
+	assert.DeepEqual(t, actual, expected)
+}
+
+func startFollowing(t *testing.T, contents string) (string, *Reader) {
+	filename := t.TempDir() + "/followed.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte(contents), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	follower, err := newFileFollower(reader, filename)
+	assert.NilError(t, err)
+	go follower.run(_TestPollInterval)
+
+	return filename, reader
+}
+
+func TestFollowAppend(t *testing.T) {
+	filename, reader := startFollowing(t, "a\nb\n")
+
+	appendToFile(t, filename, "c\nd")
+	waitForLines(t, reader, "a", "b", "c", "d")
+
+	// Completing the last line should update it rather than add a new one
+	appendToFile(t, filename, "e\nf\n")
+	waitForLines(t, reader, "a", "b", "c", "de", "f")
+}
+
+func TestFollowIncompleteLastLine(t *testing.T) {
+	filename, reader := startFollowing(t, "a\nb")
+
+	appendToFile(t, filename, "c\n")
+	waitForLines(t, reader, "a", "bc")
+}
+
+func TestFollowTruncation(t *testing.T) {
+	filename, reader := startFollowing(t, "first\nsecond\n")
+
+	assert.NilError(t, os.WriteFile(filename, []byte("new\n"), 0o600))
+	waitForLines(t, reader,
+		"first",
+		"second",
+		"--- "+filename+" was truncated, following from the start ---",
+		"new",
+	)
+}
+
+func TestFollowRotation(t *testing.T) {
+	filename, reader := startFollowing(t, "old\n")
+
+	assert.NilError(t, os.Rename(filename, filename+".1"))
+	appendToFile(t, filename+".1", "last old\n")
+	assert.NilError(t, os.WriteFile(filename, []byte("new\n"), 0o600))
+
+	waitForLines(t, reader,
+		"old",
+		"last old",
+		"--- "+filename+" was replaced, following the new file ---",
+		"new",
+	)
+}
+
+func TestFollowJsonLines(t *testing.T) {
+	filename := t.TempDir() + "/followed.jsonl"
+	assert.NilError(t, os.WriteFile(filename, []byte("{\"a\": 1}\n{\"b\": 2}\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	// Shown as more lines than there are in the file
+	reader.foldAllJson(false, 1)
+	assert.Assert(t, reader.GetLineCount() > 2)
+
+	follower, err := newFileFollower(reader, filename)
+	assert.NilError(t, err)
+	go follower.run(_TestPollInterval)
+
+	appendToFile(t, filename, "{\"c\": 3}\n")
+	waitFor(t, "Appended line never read", func() bool {
+		reader.Lock()
+		defer reader.Unlock()
+		return reader.inputLineCountUnlocked() >= 3
+	})
+
+	reader.Lock()
+	defer reader.Unlock()
+	assert.Equal(t, reader.inputLineCountUnlocked(), 3)
+	assert.Equal(t, reader.lines[2].Plain(nil), `{"c": 3}`)
+}
+
+func TestFollowStopsWhenReleased(t *testing.T) {
+	filename, reader := startFollowing(t, "a\n")
+
+	reader.release()
+	time.Sleep(10 * _TestPollInterval)
+
+	appendToFile(t, filename, "b\n")
+	time.Sleep(10 * _TestPollInterval)
+	assert.Equal(t, reader.GetLineCount(), 1)
+}
+
+func TestFollowFileBacked(t *testing.T) {
+	filename := t.TempDir() + "/followed.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("a\nb"), 0o600))
+
+	reader, err := newFileBackedReader(filename, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	follower, err := newFileFollower(reader, filename)
+	assert.NilError(t, err)
+	go follower.run(_TestPollInterval)
+
+	appendToFile(t, filename, "c\nd\n")
+	waitForLines(t, reader, "a", "bc", "d")
+}
@@ -25,6 +25,7 @@ func (p *Pager) onGotoLineKey(key twin.KeyCode) {
 	case twin.KeyEnter:
 		newLineNumber, err := strconv.Atoi(p.gotoLineString)
 		if err == nil {
+			p.pushJump()
 			p.scrollPosition = NewScrollPositionFromLineNumberOneBased(newLineNumber, "onGotoLineKey")
 		}
 		p.mode = _Viewing
@@ -53,6 +54,7 @@ func (p *Pager) onGotoLineRune(char rune) {
 	}
 
 	if char == 'g' {
+		p.pushJump()
 		p.scrollPosition = newScrollPosition("Pager scroll position")
 		p.handleScrolledUp()
 		p.mode = _Viewing
@@ -0,0 +1,241 @@
+package m
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How many bytes to show on each hex dump line
+const _HexDumpWidth = 16
+
+// Input with a larger share of control characters and invalid UTF-8 than this
+// is considered binary
+const _BinaryRatioPercent = 30
+
+// hexDump renders binary input as hex dump lines, like "hexdump -C" does.
+//
+// All methods expect the owning Reader to be locked.
+type hexDump struct {
+	// Either file or data is set. Files are read on demand, data grows while
+	// we read a stream.
+	file     *os.File
+	fileSize int64
+	data     []byte
+
+	cache *lineCache
+}
+
+// Does this look like binary data rather than text?
+func looksBinary(header []byte) bool {
+	if len(header) == 0 {
+		return false
+	}
+
+	detected := detectEncoding(header)
+	if detected != nil && !detected.asciiCompatible {
+		// UTF-16 text contains lots of zero bytes, check what it decodes to
+		// instead
+		header = []byte(detected.decode(header))
+	}
+
+	byteCount := len(header)
+	suspiciousCount := 0
+	for len(header) > 0 {
+		r, size := utf8.DecodeRune(header)
+		if r == utf8.RuneError && size <= 1 {
+			if !utf8.FullRune(header) {
+				// Incomplete character at the end
+				break
+			}
+			suspiciousCount++
+		} else if r == 0 {
+			// Text doesn't contain NUL bytes
+			return true
+		} else if r < ' ' && !strings.ContainsRune("\t\n\r\f\v\b\a\x1b", r) {
+			suspiciousCount++
+		}
+		header = header[size:]
+	}
+
+	return suspiciousCount*100 > byteCount*_BinaryRatioPercent
+}
+
+func newStreamHexDump() *hexDump {
+	return &hexDump{cache: newLineCache(_LineCacheSize)}
+}
+
+func newFileHexDump(file *os.File, fileSize int64) *hexDump {
+	return &hexDump{
+		file:     file,
+		fileSize: fileSize,
+		cache:    newLineCache(_LineCacheSize),
+	}
+}
+
+func (h *hexDump) byteCount() int64 {
+	if h.file != nil {
+		return h.fileSize
+	}
+	return int64(len(h.data))
+}
+
+func (h *hexDump) count() int {
+	return int((h.byteCount() + _HexDumpWidth - 1) / _HexDumpWidth)
+}
+
+// Get a hex dump line by its zero-based index
+func (h *hexDump) get(index int) *Line {
+	if cached := h.cache.get(index); cached != nil {
+		return cached
+	}
+
+	start := int64(index) * _HexDumpWidth
+	end := start + _HexDumpWidth
+	if end > h.byteCount() {
+		end = h.byteCount()
+	}
+
+	var lineBytes []byte
+	if h.file != nil {
+		lineBytes = make([]byte, end-start)
+		readCount, err := h.file.ReadAt(lineBytes, start)
+		if err != nil && err != io.EOF {
+			log.Warnf("Reading hex dump line %d at offset %d failed: %s", index+1, start, err)
+		}
+		lineBytes = lineBytes[:readCount]
+	} else {
+		lineBytes = h.data[start:end]
+	}
+
+	line := NewLine(formatHexDumpLine(start, lineBytes))
+	if len(lineBytes) == _HexDumpWidth {
+		// Incomplete lines can still grow, don't cache those
+		h.cache.put(index, &line)
+	}
+	return &line
+}
+
+// Format like "hexdump -C" does:
+//
+//	00000010  48 65 6c 6c 6f 0a 00 01  02 03 04 05 06 07 08 09  |Hello...........|
+func formatHexDumpLine(offset int64, lineBytes []byte) string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("\x1b[2m%08x\x1b[22m ", offset))
+
+	for i := 0; i < _HexDumpWidth; i++ {
+		if i%8 == 0 {
+			builder.WriteString(" ")
+		}
+		if i < len(lineBytes) {
+			builder.WriteString(fmt.Sprintf("%02x ", lineBytes[i]))
+		} else {
+			builder.WriteString("   ")
+		}
+	}
+
+	builder.WriteString(" |")
+	for _, b := range lineBytes {
+		if b >= ' ' && b <= '~' {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteByte('.')
+		}
+	}
+	builder.WriteString("|")
+
+	return builder.String()
+}
+
+// Collects everything read through it into the Reader's hex dump
+type _HexDumpTee struct {
+	stream io.Reader
+	reader *Reader
+}
+
+func (t *_HexDumpTee) Read(p []byte) (int, error) {
+	n, err := t.stream.Read(p)
+	if n > 0 {
+		t.reader.Lock()
+		t.reader.hexDump.data = append(t.reader.hexDump.data, p[:n]...)
+		t.reader.Unlock()
+
+		// Binary data could go on for long without any newlines, so tell the
+		// pager about the new hex dump lines here
+		select {
+		case t.reader.moreLinesAdded <- true:
+		default:
+		}
+	}
+	return n, err
+}
+
+// Turn a search string like "ca fe" or "cafe" into a pattern finding those
+// bytes in hex dump lines.
+//
+// Returns nil if the search string isn't a sequence of hex bytes. Matches
+// spanning more than one hex dump line won't be found.
+func hexSearchPattern(searchString string) *regexp.Regexp {
+	hexDigits := strings.ReplaceAll(searchString, " ", "")
+	if len(hexDigits) == 0 || len(hexDigits)%2 != 0 {
+		return nil
+	}
+	for _, char := range hexDigits {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", char) {
+			return nil
+		}
+	}
+
+	hexBytes := []string{}
+	for i := 0; i < len(hexDigits); i += 2 {
+		hexBytes = append(hexBytes, strings.ToLower(hexDigits[i:i+2]))
+	}
+
+	// Bytes are separated by one space, or by two in the middle of the line.
+	// Requiring spaces around the bytes keeps us from matching in the offsets.
+	return regexp.MustCompile(" " + strings.Join(hexBytes, " {1,2}") + " ")
+}
+
+// Is this Reader currently showing a hex dump of its input?
+func (r *Reader) isShowingHex() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.showingHex
+}
+
+// Switch between showing binary input as a hex dump and as text
+func (p *Pager) toggleHex() {
+	oldLineNumber := p.lineNumberOneBased()
+
+	p.reader.Lock()
+	if p.reader.hexDump == nil {
+		// Not binary, nothing to toggle
+		p.reader.Unlock()
+		return
+	}
+
+	// Go to the same relative position in the other view
+	oldCount := p.reader.lineCountUnlocked()
+	p.reader.showingHex = !p.reader.showingHex
+	if p.reader.filter != nil {
+		// Hex and text views have different lines
+		p.reader.updateFilterUnlocked()
+	}
+	newCount := p.reader.lineCountUnlocked()
+	p.reader.Unlock()
+
+	newLineNumber := 1
+	if oldCount > 0 {
+		newLineNumber = 1 + (oldLineNumber-1)*newCount/oldCount
+	}
+	p.scrollPosition = NewScrollPositionFromLineNumberOneBased(newLineNumber, "toggleHex")
+	p.leftColumnZeroBased = 0
+
+	// Hex and text views interpret searches differently
+	p.searchPattern = p.toSearchPattern(p.searchString)
+}
@@ -0,0 +1,121 @@
+package m
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestLooksBinary(t *testing.T) {
+	assert.Equal(t, looksBinary([]byte("")), false)
+	assert.Equal(t, looksBinary([]byte("plain text\n")), false)
+	assert.Equal(t, looksBinary([]byte("\x1b[1mbold\x1b[0m\tand tabs\r\n")), false)
+	assert.Equal(t, looksBinary([]byte("caf\xe9\n")), false)
+	assert.Equal(t, looksBinary([]byte("\xff\xfea\x00b\x00")), false)
+	assert.Equal(t, looksBinary([]byte("a\x00b\x00c\x00d\x00")), false)
+
+	assert.Equal(t, looksBinary([]byte("\x7fELF\x02\x01\x01\x00\x00")), true)
+	assert.Equal(t, looksBinary([]byte("\x01\x02\x03\xfe\x04abc")), true)
+
+	// Every other byte is zero, but this isn't UTF-16 text
+	assert.Equal(t, looksBinary([]byte("\x01\x00\x02\x00\x03\x00\x04\x00")), true)
+}
+
+func plainHexDumpLine(offset int64, lineBytes []byte) string {
+	line := NewLine(formatHexDumpLine(offset, lineBytes))
+	return line.Plain(nil)
+}
+
+func TestFormatHexDumpLine(t *testing.T) {
+	assert.Equal(t,
+		plainHexDumpLine(16, []byte("Hello\n\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09")),
+		"00000010  48 65 6c 6c 6f 0a 00 01  02 03 04 05 06 07 08 09  |Hello...........|")
+
+	assert.Equal(t,
+		plainHexDumpLine(32, []byte("Hi")),
+		"00000020  48 69                                             |Hi|")
+}
+
+func TestBinaryStream(t *testing.T) {
+	binary := append([]byte("Hello\x00World\n"), bytes.Repeat([]byte{0xff}, 16)...)
+	reader := NewReaderFromStream("binary", bytes.NewReader(binary))
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLineCount(), 2)
+	assert.Equal(t,
+		reader.GetLine(1).Plain(nil),
+		"00000000  48 65 6c 6c 6f 00 57 6f  72 6c 64 0a ff ff ff ff  |Hello.World.....|")
+
+	lines, _ := reader.GetLines(1, 2)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "binary [hex]: "), lines.statusText)
+}
+
+func TestBinaryFile(t *testing.T) {
+	filename := t.TempDir() + "/binary.bin"
+	assert.NilError(t, os.WriteFile(filename, []byte("\x7fELF\x02\x01\n\x00\x00"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLineCount(), 1)
+	assert.Equal(t,
+		reader.GetLine(1).Plain(nil),
+		"00000000  7f 45 4c 46 02 01 0a 00  00                       |.ELF.....|")
+}
+
+func TestToggleHex(t *testing.T) {
+	binary := bytes.Repeat([]byte("\x00\x01\x02\x03\x04\x05\x06\x07\n"), 10)
+	reader := NewReaderFromStream("binary", bytes.NewReader(binary))
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	assert.Equal(t, reader.GetLineCount(), 6) // 90 bytes, 16 per line
+
+	pager.onRune('x')
+	assert.Equal(t, reader.GetLineCount(), 10)
+
+	pager.onRune('x')
+	assert.Equal(t, reader.GetLineCount(), 6)
+
+	// Toggling text shouldn't do anything
+	textReader := NewReaderFromText("text", "a\nb")
+	pager = NewPager(textReader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.onRune('x')
+	assert.Equal(t, textReader.GetLineCount(), 2)
+}
+
+func TestHexSearch(t *testing.T) {
+	binary := append(bytes.Repeat([]byte{0}, 40), 0xca, 0xfe, 0xba, 0xbe)
+	reader := NewReaderFromStream("binary", bytes.NewReader(binary))
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.searchString = "cafe babe"
+	pager.updateSearchPattern()
+	assert.Assert(t, !pager.searchPattern.MatchString(reader.GetLine(1).Plain(nil)))
+	assert.Assert(t, pager.searchPattern.MatchString(reader.GetLine(3).Plain(nil)))
+
+	// Bytes on both sides of the middle of a line
+	pager.searchString = "0000"
+	pager.updateSearchPattern()
+	assert.Assert(t, pager.searchPattern.MatchString(reader.GetLine(1).Plain(nil)))
+
+	// Not hex, search for text instead
+	pager.searchString = "hello"
+	pager.updateSearchPattern()
+	assert.Equal(t, pager.searchPattern.String(), "(?i)hello")
+
+	assert.Assert(t, hexSearchPattern("abc") == nil)
+	assert.Assert(t, hexSearchPattern("xy") == nil)
+}
@@ -2,8 +2,11 @@ package m
 
 import (
 	"bytes"
-	"os"
+	"fmt"
+	"path"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/lexers"
@@ -11,31 +14,152 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// Files larger than this won't be highlighted
+// How many lines to highlight at a time
+const _HighlightChunkSize = 500
+
+// Inputs up to this size are highlighted all at once when they have been fully
+// read. Larger inputs are highlighted in chunks.
 const MAX_HIGHLIGHT_SIZE int64 = 1024 * 1024
 
-// Read and highlight a file using Chroma: https://github.com/alecthomas/chroma
+// What highlightIncrementally() goes by, lowered by tests that don't want to
+// wait for highlighting a megabyte
+var highlightAllMaxSize = MAX_HIGHLIGHT_SIZE
+
+// How long to wait for more input before highlighting the lines we have
+const _HighlightMaxWait = 500 * time.Millisecond
+
+// How many lines before and after a chunk to highlight along with it, so that
+// constructs like block comments crossing the chunk borders get the right
+// colors
+const _HighlightContextLines = 100
+
+// Vim and Emacs modelines, like "vim: ft=python" or "-*- mode: ruby -*-"
+var vimModeline = regexp.MustCompile(`\bvim?:.*\b(?:ft|filetype|syntax)=([\w+-]+)`)
+var emacsModeline = regexp.MustCompile(`-\*-\s*(?:.*;\s*)?(?:mode:\s*)?([\w+-]+)\s*(?:;.*)?-\*-`)
+
+// How many lines at the start and at the end of the input to look for
+// modelines in
+const _ModelineLineCount = 5
+
+// SetLanguage makes Readers created with these options highlight their input
+// using the named Chroma lexer, rather than guessing what language the input
+// is in.
 //
-// If force is true, file will always be highlighted. If force is false, files
-// larger than MAX_HIGHLIGHT_SIZE will not be highlighted.
+// The name can be any Chroma lexer name or alias, like "python", "go" or
+// "bash". Pass an empty string to go back to guessing.
+func (options *ReaderOptions) SetLanguage(name string) error {
+	if name == "" {
+		options.lexer = nil
+		return nil
+	}
+
+	lexer := lexers.Get(name)
+	if lexer == nil {
+		return fmt.Errorf("no highlighting available for language: %s", name)
+	}
+
+	options.lexer = lexer
+	return nil
+}
+
+// Figure out how to highlight some text.
 //
-// Returns nil with no error if highlighting would be a no-op.
-func highlight(filename string, force bool, style chroma.Style, formatter chroma.Formatter) (*string, error) {
-	// Highlight input file using Chroma:
-	// https://github.com/alecthomas/chroma
-	fileInfo, err := os.Stat(filename)
-	if err != nil {
-		return nil, err
+// The filename is matched against Chroma's file name patterns first, and can
+// be empty for streams. After that we look for modelines and "#!" lines, and
+// finally let Chroma's content analysers guess.
+//
+// Returns nil if we don't know how to highlight this text.
+func pickLexer(filename string, text string) chroma.Lexer {
+	if filename != "" {
+		lexer := lexers.Match(filename)
+		if lexer != nil {
+			return lexer
+		}
 	}
-	if fileInfo.Size() > MAX_HIGHLIGHT_SIZE && !force {
-		log.Debugf("Not highlighting %s because it is %d bytes large, which is larger than moar's built-in highlighting limit of %d bytes",
-			filename, fileInfo.Size(), MAX_HIGHLIGHT_SIZE)
-		return nil, nil
+
+	lexer := modelineLexer(text)
+	if lexer != nil {
+		return lexer
+	}
+
+	lexer = shebangLexer(text)
+	if lexer != nil {
+		return lexer
+	}
+
+	return lexers.Analyse(text)
+}
+
+// Find a lexer for the interpreter named on a "#!" first line, like
+// "#!/usr/bin/env python3" or "#!/usr/bin/perl -w"
+func shebangLexer(text string) chroma.Lexer {
+	if !strings.HasPrefix(text, "#!") {
+		return nil
+	}
+
+	firstLine, _, _ := strings.Cut(text[2:], "\n")
+	words := strings.Fields(firstLine)
+	if len(words) == 0 {
+		return nil
+	}
+
+	interpreter := path.Base(words[0])
+	if interpreter == "env" {
+		// Skip any env options, like in "#!/usr/bin/env -S deno run"
+		words = words[1:]
+		for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			return nil
+		}
+		interpreter = path.Base(words[0])
 	}
 
-	lexer := lexers.Match(filename)
+	lexer := lexers.Get(interpreter)
+	if lexer != nil {
+		return lexer
+	}
+
+	// Try without any version number, "python3.11" -> "python"
+	unversioned := strings.TrimRight(interpreter, "0123456789.")
+	if unversioned == "" || unversioned == interpreter {
+		return nil
+	}
+	return lexers.Get(unversioned)
+}
+
+// Find a lexer named by a Vim or Emacs modeline at the start or the end of the
+// text
+func modelineLexer(text string) chroma.Lexer {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > 2*_ModelineLineCount {
+		lines = append(lines[:_ModelineLineCount], lines[len(lines)-_ModelineLineCount:]...)
+	}
+
+	for _, line := range lines {
+		for _, modeline := range []*regexp.Regexp{vimModeline, emacsModeline} {
+			match := modeline.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			lexer := lexers.Get(match[1])
+			if lexer != nil {
+				return lexer
+			}
+		}
+	}
+
+	return nil
+}
+
+// Highlight some text using the given lexer.
+//
+// Returns nil with no error if highlighting would be a no-op.
+func highlightText(text string, lexer chroma.Lexer, style chroma.Style, formatter chroma.Formatter) (*string, error) {
 	if lexer == nil {
-		// No highlighter available for this file type
+		// No highlighter available for this text
 		return nil, nil
 	}
 
@@ -53,12 +177,7 @@ func highlight(filename string, force bool, style chroma.Style, formatter chroma
 	// with and without.
 	lexer = chroma.Coalesce(lexer)
 
-	contents, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
-	iterator, err := lexer.Tokenise(nil, string(contents))
+	iterator, err := lexer.Tokenise(nil, text)
 	if err != nil {
 		return nil, err
 	}
@@ -79,3 +198,305 @@ func highlight(filename string, force bool, style chroma.Style, formatter chroma
 
 	return &trimmed, nil
 }
+
+// Highlight the lines of this Reader, replacing plain lines with highlighted
+// ones in place.
+//
+// Inputs up to MAX_HIGHLIGHT_SIZE bytes are highlighted all at once when they
+// have been fully read. Larger inputs, and inputs that take too long to read,
+// are highlighted in chunks, with the chunk closest to what the pager last
+// showed going first, so what the user looks at gets colors right away. Then
+// we work our way outwards in the background. Each chunk is highlighted along
+// with the _HighlightContextLines lines before and after it, so only
+// constructs longer than that, like very long block comments, may get the
+// wrong colors.
+//
+// The last incomplete chunk is highlighted when no more input has arrived for
+// _HighlightMaxWait.
+//
+// File backed Readers get their lines highlighted as they are shown instead,
+// see fileBackedLines.highlight().
+//
+// The filename is used for picking a lexer, and can be empty for streams.
+func (reader *Reader) highlightIncrementally(filename string, style chroma.Style, formatter chroma.Formatter) {
+	defer func() {
+		reader.highlightingDone.Store(true)
+		select {
+		case reader.maybeDone <- true:
+		default:
+		}
+
+		log.Trace("Highlighting done")
+	}()
+
+	// Until then, wait for all input to arrive so we can highlight it in one go
+	highlightAllDeadline := time.Now().Add(_HighlightMaxWait)
+	highlightAllTimedOut := false
+
+	lexer := reader.options.lexer
+	if lexer == nil {
+		lexer = reader.waitForLexer(filename)
+	}
+	if lexer == nil {
+		// No highlighter available for this input
+		return
+	}
+	log.Debug("Highlighting as ", lexer.Config().Name)
+
+	reader.Lock()
+	fileLines := reader.fileLines
+	if fileLines != nil {
+		fileLines.lexer = lexer
+		fileLines.style = style
+		fileLines.formatter = formatter
+	}
+	reader.Unlock()
+	if fileLines != nil {
+		// Make the pager redraw, highlighting what it shows
+		select {
+		case reader.moreLinesAdded <- true:
+		default:
+		}
+		return
+	}
+
+	// How many lines of each chunk we have highlighted
+	highlightedCounts := map[int]int{}
+
+	// Set when no more input has arrived for a while
+	idle := false
+	for {
+		reader.Lock()
+
+		// Check done before looking at the lines, if the Reader is done then
+		// we know all lines are there
+		done := reader.done.Load()
+		inputChanged := reader.inputChangedUnlocked()
+
+		if reader.replaced || reader.hexDump != nil {
+			reader.Unlock()
+			return
+		}
+
+		highlightAll := !highlightAllTimedOut && reader.bytesRead <= highlightAllMaxSize
+		if highlightAll && !done {
+			// Wait and see whether all of it is small enough for highlighting
+			// in one go
+			reader.Unlock()
+			timeLeft := time.Until(highlightAllDeadline)
+			if timeLeft > 0 {
+				waitForInput(inputChanged, timeLeft)
+			} else {
+				// Input is slow in coming, highlight what we have in chunks
+				highlightAllTimedOut = true
+				idle = true
+			}
+			continue
+		}
+
+		firstIndex := 0
+		lastIndex := len(reader.lines)
+		if !highlightAll {
+			chunk := nextHighlightChunk(highlightedCounts, len(reader.lines), reader.highlightFocus, done || idle)
+			if chunk < 0 {
+				reader.Unlock()
+				if done {
+					return
+				}
+
+				// Wait for more lines to highlight
+				idle = !waitForInput(inputChanged, _HighlightMaxWait)
+				continue
+			}
+
+			chunkStart := chunk * _HighlightChunkSize
+			firstIndex = chunkStart + highlightedCounts[chunk]
+			lastIndex = chunkStart + _HighlightChunkSize
+			if lastIndex > len(reader.lines) {
+				lastIndex = len(reader.lines)
+			}
+			highlightedCounts[chunk] = lastIndex - chunkStart
+		}
+
+		contextFirst, contextLast := highlightContext(firstIndex, lastIndex, len(reader.lines))
+		contextLines := make([]*Line, contextLast-contextFirst)
+		copy(contextLines, reader.lines[contextFirst:contextLast])
+		plainLines := contextLines[firstIndex-contextFirst : lastIndex-contextFirst]
+		reader.Unlock()
+
+		highlightedLines := highlightLines(contextLines, firstIndex-contextFirst, lastIndex-contextFirst, lexer, style, formatter)
+		if highlightedLines != nil {
+			reader.Lock()
+			for i, highlighted := range highlightedLines {
+				lineIndex := firstIndex + i
+				if lineIndex >= len(reader.lines) || reader.lines[lineIndex] != plainLines[i] {
+					// This line was replaced while we were highlighting it
+					continue
+				}
+				reader.lines[lineIndex] = highlighted
+			}
+			reader.Unlock()
+
+			// Make the pager redraw with the new colors
+			select {
+			case reader.moreLinesAdded <- true:
+			default:
+			}
+		}
+
+		if highlightAll {
+			return
+		}
+	}
+}
+
+// Wait for enough lines to guess the language from, then pick a lexer.
+//
+// Returns nil if the input shouldn't be highlighted.
+func (reader *Reader) waitForLexer(filename string) chroma.Lexer {
+	// Guess from what we have if the input is slow in coming
+	deadline := time.Now().Add(_HighlightMaxWait)
+	for {
+		reader.Lock()
+		done := reader.done.Load()
+		inputChanged := reader.inputChangedUnlocked()
+
+		if reader.replaced || reader.hexDump != nil {
+			reader.Unlock()
+			return nil
+		}
+		lineCount := reader.inputLineCountUnlocked()
+		timeLeft := time.Until(deadline)
+		if !done && lineCount < _HighlightChunkSize && timeLeft > 0 {
+			reader.Unlock()
+			waitForInput(inputChanged, timeLeft)
+			continue
+		}
+
+		firstLines := []string{}
+		for lineIndex := 0; lineIndex < lineCount && lineIndex < _HighlightChunkSize; lineIndex++ {
+			firstLines = append(firstLines, reader.inputLineUnlocked(lineIndex).raw)
+		}
+		reader.Unlock()
+
+		lexer := pickLexer(filename, strings.Join(firstLines, "\n"))
+		if lexer == nil {
+			return nil
+		}
+
+		// FIXME: Can we test for the lexer implementation class instead? That
+		// should be more resilient towards this arbitrary string changing if we
+		// upgrade Chroma at some point.
+		if lexer.Config().Name == "plaintext" {
+			// This highlighter doesn't provide any highlighting, but not doing
+			// anything at all is cheaper and simpler, so we do that.
+			return nil
+		}
+
+		return lexer
+	}
+}
+
+// Find the chunk with unhighlighted lines closest to the focus line.
+//
+// An incomplete chunk at the end is only highlighted if withIncomplete is
+// set, since otherwise more lines could be coming soon.
+//
+// Returns -1 if there is nothing to highlight right now.
+func nextHighlightChunk(highlightedCounts map[int]int, lineCount int, focusIndex int, withIncomplete bool) int {
+	chunkCount := lineCount / _HighlightChunkSize
+	if withIncomplete && lineCount%_HighlightChunkSize != 0 {
+		chunkCount++
+	}
+
+	focusChunk := focusIndex / _HighlightChunkSize
+	if focusChunk >= chunkCount {
+		focusChunk = chunkCount - 1
+	}
+
+	for distance := 0; distance < chunkCount; distance++ {
+		for _, chunk := range []int{focusChunk + distance, focusChunk - distance} {
+			if chunk < 0 || chunk >= chunkCount {
+				continue
+			}
+
+			chunkLineCount := lineCount - chunk*_HighlightChunkSize
+			if chunkLineCount > _HighlightChunkSize {
+				chunkLineCount = _HighlightChunkSize
+			}
+			if highlightedCounts[chunk] >= chunkLineCount {
+				continue
+			}
+			return chunk
+		}
+	}
+
+	return -1
+}
+
+// The lines to highlight along with the lines from firstIndex up to lastIndex,
+// so that constructs starting before or ending after those get the right
+// colors
+func highlightContext(firstIndex int, lastIndex int, lineCount int) (int, int) {
+	contextFirst := firstIndex - _HighlightContextLines
+	if contextFirst < 0 {
+		contextFirst = 0
+	}
+
+	contextLast := lastIndex + _HighlightContextLines
+	if contextLast > lineCount {
+		contextLast = lineCount
+	}
+
+	return contextFirst, contextLast
+}
+
+// Highlight the lines from firstIndex up to lastIndex, returning nil if they
+// should be left alone.
+//
+// The other lines are only used for getting the highlighting of those right,
+// see highlightContext(). They may already be highlighted.
+func highlightLines(lines []*Line, firstIndex int, lastIndex int, lexer chroma.Lexer, style chroma.Style, formatter chroma.Formatter) []*Line {
+	rawLines := make([]string, 0, len(lines))
+	for lineIndex, line := range lines {
+		if lineIndex < firstIndex || lineIndex >= lastIndex {
+			rawLines = append(rawLines, line.Plain(nil))
+			continue
+		}
+
+		if strings.ContainsAny(line.raw, "\x1b\b") {
+			// Already highlighted, or a man page
+			return nil
+		}
+		rawLines = append(rawLines, line.raw)
+	}
+
+	highlighted, err := highlightText(strings.Join(rawLines, "\n")+"\n", lexer, style, formatter)
+	if err != nil {
+		log.Warn("Highlighting failed: ", err)
+		return nil
+	}
+	if highlighted == nil {
+		return nil
+	}
+
+	highlightedStrings := strings.Split(*highlighted, "\n")
+	if len(highlightedStrings) == len(rawLines)+1 {
+		// Input ended with a newline, drop the empty line after it
+		highlightedStrings = highlightedStrings[:len(rawLines)]
+	}
+	if len(highlightedStrings) != len(rawLines) {
+		log.Debugf("Not highlighting, got %d highlighted lines from %d plain ones",
+			len(highlightedStrings), len(rawLines))
+		return nil
+	}
+	highlightedStrings = highlightedStrings[firstIndex:lastIndex]
+
+	highlightedLines := make([]*Line, 0, len(highlightedStrings))
+	for _, highlightedString := range highlightedStrings {
+		line := NewLine(highlightedString)
+		line.highlighted = true
+		highlightedLines = append(highlightedLines, &line)
+	}
+	return highlightedLines
+}
@@ -0,0 +1,168 @@
+package m
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+func lexerName(filename string, text string) string {
+	lexer := pickLexer(filename, text)
+	if lexer == nil {
+		return ""
+	}
+	return lexer.Config().Name
+}
+
+func TestPickLexer(t *testing.T) {
+	assert.Equal(t, lexerName("main.go", "package main\n"), "Go")
+	assert.Equal(t, lexerName("", "#!/usr/bin/env python3\nprint('hello')\n"), "Python")
+	assert.Equal(t, lexerName("", "#!/bin/bash\necho hello\n"), "Bash")
+	assert.Equal(t, lexerName("", "#!/usr/bin/perl -w\nprint 'hello';\n"), "Perl")
+	assert.Equal(t, lexerName("", "#!/usr/bin/env -S python3.11 -u\nprint('hello')\n"), "Python")
+	assert.Equal(t, lexerName("", "puts 'hello'\n# vim: set ft=ruby:\n"), "Ruby")
+	assert.Equal(t, lexerName("", "# -*- mode: python -*-\nprint('hello')\n"), "Python")
+	assert.Equal(t, lexerName("", "Just some text\n"), "")
+}
+
+func TestHighlightStream(t *testing.T) {
+	reader := NewHighlightingReaderFromStream("",
+		strings.NewReader("#!/usr/bin/env python3\nprint('hello')\n"),
+		*styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLineCount(), 2)
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "print('hello')")
+	assert.Assert(t, strings.Contains(reader.GetLine(2).raw, "\x1b["), reader.GetLine(2).raw)
+}
+
+func TestHighlightStreamAlreadyFormatted(t *testing.T) {
+	colored := "#!/usr/bin/env python3\n\x1b[31mprint('hello')\x1b[m\n"
+	reader := NewHighlightingReaderFromStream("", strings.NewReader(colored),
+		*styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, reader._wait())
+
+	// Existing formatting should be kept
+	assert.Equal(t, reader.GetLine(2).raw, "\x1b[31mprint('hello')\x1b[m")
+}
+
+// Highlight inputs larger than this in chunks during this test
+func setHighlightAllMaxSize(t *testing.T, size int64) {
+	original := highlightAllMaxSize
+	highlightAllMaxSize = size
+	t.Cleanup(func() {
+		highlightAllMaxSize = original
+	})
+}
+
+func TestNextHighlightChunk(t *testing.T) {
+	highlighted := map[int]int{}
+
+	// Nothing complete to highlight yet
+	assert.Equal(t, nextHighlightChunk(highlighted, _HighlightChunkSize-1, 0, false), -1)
+
+	// The last incomplete chunk can be highlighted once we're done
+	assert.Equal(t, nextHighlightChunk(highlighted, _HighlightChunkSize-1, 0, true), 0)
+
+	// And again when more lines have arrived
+	highlighted[0] = _HighlightChunkSize - 1
+	assert.Equal(t, nextHighlightChunk(highlighted, _HighlightChunkSize-1, 0, true), -1)
+	assert.Equal(t, nextHighlightChunk(highlighted, _HighlightChunkSize, 0, false), 0)
+	delete(highlighted, 0)
+
+	// Start at the focus line and work outwards
+	lineCount := 5*_HighlightChunkSize + 1
+	focus := 2*_HighlightChunkSize + 7
+	order := []int{}
+	for {
+		chunk := nextHighlightChunk(highlighted, lineCount, focus, true)
+		if chunk < 0 {
+			break
+		}
+		highlighted[chunk] = _HighlightChunkSize
+		order = append(order, chunk)
+	}
+	assert.DeepEqual(t, order, []int{2, 3, 1, 4, 0, 5})
+}
+
+func TestHighlightLargeFile(t *testing.T) {
+	setHighlightAllMaxSize(t, 1000)
+
+	// Larger than what we used to be able to highlight
+	filename := t.TempDir() + "/large.go"
+	source := "package main\n" + strings.Repeat("var x = \"some string to make this file larger\"\n", 3*_HighlightChunkSize)
+	assert.NilError(t, os.WriteFile(filename, []byte(source), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLineCount(), 3*_HighlightChunkSize+1)
+	lastLine := reader.GetLine(3*_HighlightChunkSize + 1)
+	assert.Equal(t, lastLine.Plain(nil), "var x = \"some string to make this file larger\"")
+	assert.Assert(t, strings.Contains(lastLine.raw, "\x1b["), lastLine.raw)
+}
+
+func TestHighlightCommentSpanningChunks(t *testing.T) {
+	setHighlightAllMaxSize(t, 1000)
+
+	// Comment starting in the first chunk and ending in the second one
+	filename := t.TempDir() + "/comment.go"
+	source := "package main\n" +
+		strings.Repeat("var x = 1\n", _HighlightChunkSize-_HighlightContextLines/2) +
+		"/*\n" + strings.Repeat("still in the comment\n", _HighlightContextLines) + "*/\n"
+	assert.NilError(t, os.WriteFile(filename, []byte(source), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	// Highlighted like in a short comment, in both chunks
+	short, err := highlightText("package main\n/*\nstill in the comment\n*/\n",
+		lexers.Get("go"), *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	commentLine := strings.Split(*short, "\n")[2]
+	firstCommentLine := _HighlightChunkSize - _HighlightContextLines/2 + 3
+	assert.Equal(t, reader.GetLine(firstCommentLine).raw, commentLine)
+	assert.Equal(t, reader.GetLine(_HighlightChunkSize+1).raw, commentLine)
+}
+
+func TestHighlightUnfinishedStream(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+
+	reader := NewHighlightingReaderFromStream("", pipeReader, *styles.Get("native"), formatters.TTY16m)
+	_, err := pipeWriter.Write([]byte("#!/usr/bin/env python3\nprint('hello')\n"))
+	assert.NilError(t, err)
+
+	// Small enough for highlighting in one go, but not done
+	waitFor(t, "Unfinished stream never highlighted", func() bool {
+		return reader.GetLineCount() == 2 && strings.Contains(reader.GetLine(2).raw, "\x1b[")
+	})
+	assert.Assert(t, !reader.done.Load())
+}
+
+func TestHighlightFileBacked(t *testing.T) {
+	filename := t.TempDir() + "/large.go"
+	source := "package main\n" + strings.Repeat("var x = 1\n", 3*_HighlightChunkSize)
+	assert.NilError(t, os.WriteFile(filename, []byte(source), 0o600))
+
+	// Like NewReaderFromFilename() does for files too large to keep in memory
+	reader, err := newFileBackedReader(filename, nil)
+	assert.NilError(t, err)
+	reader.highlightingDone.Store(false)
+	go reader.highlightIncrementally(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, reader._wait())
+
+	// Highlighted when shown
+	lines, _ := reader.GetLines(3*_HighlightChunkSize+1, 1)
+	lastLine := lines.lines[0]
+	assert.Equal(t, lastLine.Plain(nil), "var x = 1")
+	assert.Assert(t, strings.Contains(lastLine.raw, "\x1b["), lastLine.raw)
+}
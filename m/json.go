@@ -0,0 +1,656 @@
+package m
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	log "github.com/sirupsen/logrus"
+)
+
+// A JSON value, with object members in input order
+type _JsonNode struct {
+	// Set for object members
+	key *string
+
+	// nil for top level values
+	parent *_JsonNode
+
+	// "{" or "[" for objects and arrays, empty for other values
+	opening  string
+	children []*_JsonNode
+
+	// JSON text for values that aren't objects or arrays
+	scalar string
+
+	folded bool
+}
+
+// A top level JSON value, or an input line that isn't JSON
+type _JsonRecord struct {
+	raw *Line
+
+	// Which input line this JSON lines record is from
+	inputLineIndex int
+
+	// JSON lines records are parsed when they are first shown
+	parsed bool
+
+	// nil if the input isn't JSON
+	root *_JsonNode
+
+	// The rendered lines and which node each line shows. A record that hasn't
+	// been rendered yet is one line.
+	lines []*Line
+	nodes []*_JsonNode
+
+	// On which of the lines each node starts
+	nodeOffsets map[*_JsonNode]int
+
+	// The zero-based index of the first view line showing this record
+	firstLineIndex int
+}
+
+// Input shown as JSON, either one JSON document or JSON lines with one record
+// per input line
+type _JsonView struct {
+	records []*_JsonRecord
+
+	// JSON documents are parsed when they have been fully read, while JSON
+	// lines get one record per input line as the lines come in
+	isDocument     bool
+	inputLineCount int
+
+	// For each line of the view, the record it is in and where in that
+	// record it is
+	lineRecords []*_JsonRecord
+	lineOffsets []int
+
+	style     chroma.Style
+	formatter chroma.Formatter
+}
+
+// How many lines to check for whether input could be a JSON document, before
+// waiting for all of it
+const _JsonDetectLineCount = 100
+
+// ForceJson makes Readers created with these options show all input as JSON,
+// rather than just input starting with '{' or '['.
+func (options *ReaderOptions) ForceJson(force bool) {
+	options.forceJson = force
+}
+
+// Encode a string as JSON, without escaping HTML characters like
+// json.Marshal() does
+func jsonString(s string) string {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(s)
+	if err != nil {
+		// Strings can always be encoded
+		panic(err)
+	}
+
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// Parse the next JSON value from the decoder
+func parseJsonValue(decoder *json.Decoder) (*_JsonNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		node := &_JsonNode{opening: string(token)}
+		for decoder.More() {
+			var key *string
+			if token == '{' {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				keyString := keyToken.(string)
+				key = &keyString
+			}
+
+			child, err := parseJsonValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			child.key = key
+			child.parent = node
+			node.children = append(node.children, child)
+		}
+
+		// Consume the closing delimiter
+		_, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return node, err
+	case string:
+		return &_JsonNode{scalar: jsonString(token)}, nil
+	case json.Number:
+		return &_JsonNode{scalar: token.String()}, nil
+	case bool:
+		return &_JsonNode{scalar: strconv.FormatBool(token)}, nil
+	case nil:
+		return &_JsonNode{scalar: "null"}, nil
+	}
+
+	return nil, errors.New("unexpected JSON token")
+}
+
+// Parse text into one node per top level JSON value
+func parseJsonValues(text string) ([]*_JsonNode, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	roots := []*_JsonNode{}
+	for decoder.More() {
+		root, err := parseJsonValue(decoder)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+
+	// decoder.More() is false both at the end and at stray closing brackets
+	_, err := decoder.Token()
+	if !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after JSON")
+	}
+
+	return roots, nil
+}
+
+func (node *_JsonNode) closing() string {
+	if node.opening == "{" {
+		return "}"
+	}
+	return "]"
+}
+
+// The whole node on one line
+func (node *_JsonNode) compact() string {
+	if node.opening == "" {
+		return node.scalar
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(node.opening)
+	for i, child := range node.children {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		if child.key != nil {
+			builder.WriteString(jsonString(*child.key) + ": ")
+		}
+		builder.WriteString(child.compact())
+	}
+	builder.WriteString(node.closing())
+
+	return builder.String()
+}
+
+// Render the node as indented lines, with folded objects and arrays on one
+// line each. The suffix goes after the last line, it's a comma for all but
+// the last member of objects and arrays.
+func (node *_JsonNode) render(indent string, suffix string, texts *[]string, nodes *[]*_JsonNode) {
+	prefix := indent
+	if node.key != nil {
+		prefix += jsonString(*node.key) + ": "
+	}
+
+	if node.opening == "" || node.folded || len(node.children) == 0 {
+		*texts = append(*texts, prefix+node.compact()+suffix)
+		*nodes = append(*nodes, node)
+		return
+	}
+
+	*texts = append(*texts, prefix+node.opening)
+	*nodes = append(*nodes, node)
+	for i, child := range node.children {
+		childSuffix := ","
+		if i == len(node.children)-1 {
+			childSuffix = ""
+		}
+		child.render(indent+"  ", childSuffix, texts, nodes)
+	}
+	*texts = append(*texts, indent+node.closing()+suffix)
+	*nodes = append(*nodes, node)
+}
+
+// Fold or unfold this node and all objects and arrays inside of it
+func (node *_JsonNode) setFoldedRecursively(folded bool) {
+	if node.opening == "" {
+		return
+	}
+
+	node.folded = folded
+	for _, child := range node.children {
+		child.setFoldedRecursively(folded)
+	}
+}
+
+// Parse JSON lines records, which start out with everything folded
+func (record *_JsonRecord) parse() {
+	if record.parsed {
+		return
+	}
+
+	record.parsed = true
+	roots, err := parseJsonValues(record.raw.Plain(nil))
+	if err == nil && len(roots) == 1 {
+		record.root = roots[0]
+		record.root.setFoldedRecursively(true)
+	}
+}
+
+// Render and highlight the record
+func (record *_JsonRecord) render(style chroma.Style, formatter chroma.Formatter) {
+	record.parse()
+	if record.root == nil {
+		record.lines = []*Line{record.raw}
+		record.nodes = []*_JsonNode{nil}
+		record.nodeOffsets = nil
+		return
+	}
+
+	texts := []string{}
+	nodes := []*_JsonNode{}
+	record.root.render("", "", &texts, &nodes)
+
+	lines := linesFromStrings(texts)
+	highlighted := highlightLines(lines, 0, len(lines), lexers.Get("json"), style, formatter)
+	if highlighted != nil {
+		lines = highlighted
+	}
+
+	record.lines = lines
+	record.nodes = nodes
+	record.nodeOffsets = map[*_JsonNode]int{}
+	for offset, node := range nodes {
+		if _, found := record.nodeOffsets[node]; !found {
+			record.nodeOffsets[node] = offset
+		}
+	}
+}
+
+func (record *_JsonRecord) lineCount() int {
+	if record.lines == nil {
+		return 1
+	}
+	return len(record.lines)
+}
+
+// A view of one JSON document, with all objects and arrays unfolded
+func newJsonDocumentView(roots []*_JsonNode, style chroma.Style, formatter chroma.Formatter) *_JsonView {
+	view := &_JsonView{
+		isDocument: true,
+		style:      style,
+		formatter:  formatter,
+	}
+
+	for _, root := range roots {
+		record := &_JsonRecord{parsed: true, root: root}
+		record.render(style, formatter)
+		view.records = append(view.records, record)
+	}
+	view.relayout()
+
+	return view
+}
+
+// Add records for new input lines. JSON documents don't change once parsed.
+func (view *_JsonView) update(inputLines []*Line) {
+	if view.isDocument || len(inputLines) < view.inputLineCount {
+		return
+	}
+
+	if view.inputLineCount > 0 {
+		last := view.records[len(view.records)-1]
+		line := inputLines[view.inputLineCount-1]
+		if line != last.raw {
+			if line.Plain(nil) == last.raw.Plain(nil) {
+				// Highlighted, show the new colors for non-JSON lines
+				last.raw = line
+				if last.root == nil {
+					last.lines = nil
+				}
+			} else {
+				// An incomplete last line was completed while following
+				*last = _JsonRecord{raw: line, inputLineIndex: last.inputLineIndex}
+				view.relayout()
+			}
+		}
+	}
+
+	for _, line := range inputLines[view.inputLineCount:] {
+		record := &_JsonRecord{raw: line, inputLineIndex: len(view.records), firstLineIndex: len(view.lineRecords)}
+		view.records = append(view.records, record)
+		view.lineRecords = append(view.lineRecords, record)
+		view.lineOffsets = append(view.lineOffsets, 0)
+	}
+	view.inputLineCount = len(inputLines)
+}
+
+// Recompute which line of the view is in which record, after records have
+// changed size
+func (view *_JsonView) relayout() {
+	view.lineRecords = view.lineRecords[:0]
+	view.lineOffsets = view.lineOffsets[:0]
+	for _, record := range view.records {
+		record.firstLineIndex = len(view.lineRecords)
+		for offset := 0; offset < record.lineCount(); offset++ {
+			view.lineRecords = append(view.lineRecords, record)
+			view.lineOffsets = append(view.lineOffsets, offset)
+		}
+	}
+}
+
+func (view *_JsonView) lineCount() int {
+	return len(view.lineRecords)
+}
+
+// Get a line by its zero-based index, which must be in range
+func (view *_JsonView) getLine(lineIndex int) *Line {
+	record := view.lineRecords[lineIndex]
+	if record.lines == nil {
+		record.render(view.style, view.formatter)
+	}
+
+	return record.lines[view.lineOffsets[lineIndex]]
+}
+
+// The zero-based index of the first line showing this node. For nodes that
+// are folded away, that's the line of the nearest ancestor that isn't.
+func (view *_JsonView) nodeLineIndex(record *_JsonRecord, node *_JsonNode) int {
+	for ; node != nil; node = node.parent {
+		offset, found := record.nodeOffsets[node]
+		if found {
+			return record.firstLineIndex + offset
+		}
+	}
+
+	return record.firstLineIndex
+}
+
+// Fold or unfold the object or array on a line. On other values, fold the
+// object or array they are in. Returns the zero-based index of the first line
+// of what was folded or unfolded.
+func (view *_JsonView) toggleFold(lineIndex int) int {
+	record := view.lineRecords[lineIndex]
+	if record.lines == nil {
+		record.render(view.style, view.formatter)
+	}
+
+	node := record.nodes[view.lineOffsets[lineIndex]]
+	if node == nil {
+		// Not JSON
+		return lineIndex
+	}
+
+	if node.opening == "" || len(node.children) == 0 {
+		node = node.parent
+		if node == nil {
+			// A top level value that can't be folded
+			return lineIndex
+		}
+		node.folded = true
+	} else {
+		node.folded = !node.folded
+	}
+
+	record.render(view.style, view.formatter)
+	view.relayout()
+
+	return view.nodeLineIndex(record, node)
+}
+
+// Fold or unfold all objects and arrays. Top level values of JSON documents
+// stay unfolded, so that their members are still visible. Returns the new
+// zero-based index of the first line of the record that was on the given
+// line.
+func (view *_JsonView) foldAll(folded bool, lineIndex int) int {
+	var cursorRecord *_JsonRecord
+	if lineIndex < len(view.lineRecords) {
+		cursorRecord = view.lineRecords[lineIndex]
+	}
+
+	for _, record := range view.records {
+		if !record.parsed && folded {
+			// Unparsed records are already folded
+			continue
+		}
+		record.parse()
+		if record.root == nil {
+			continue
+		}
+
+		record.root.setFoldedRecursively(folded)
+		if view.isDocument {
+			record.root.folded = false
+		}
+		record.render(view.style, view.formatter)
+	}
+	view.relayout()
+
+	if cursorRecord == nil {
+		return 0
+	}
+	return view.nodeLineIndex(cursorRecord, cursorRecord.root)
+}
+
+// Wait for the first non-empty input line. Returns false if there is none, or
+// if the input won't be shown as JSON or log lines anyway.
+func (reader *Reader) waitForFirstLine() (string, bool) {
+	for {
+		reader.Lock()
+		done := reader.done.Load()
+		inputChanged := reader.inputChangedUnlocked()
+
+		if reader.replaced || reader.fileLines != nil || reader.hexDump != nil || reader.table != nil || reader.directory != nil {
+			reader.Unlock()
+			return "", false
+		}
+
+		for _, line := range reader.lines {
+			firstLine := strings.TrimSpace(line.Plain(nil))
+			if firstLine != "" {
+				reader.Unlock()
+				return firstLine, true
+			}
+		}
+		reader.Unlock()
+
+		if done {
+			return "", false
+		}
+		<-inputChanged
+	}
+}
+
+// Check the first lines of input that could be a JSON document, so that we
+// don't wait for all of some input that obviously isn't.
+func (reader *Reader) mayBeJsonDocument() bool {
+	for {
+		reader.Lock()
+		done := reader.done.Load()
+		inputChanged := reader.inputChangedUnlocked()
+
+		if reader.replaced {
+			reader.Unlock()
+			return false
+		}
+
+		if !done && len(reader.lines) < _JsonDetectLineCount {
+			reader.Unlock()
+			<-inputChanged
+			continue
+		}
+
+		plainLines := []string{}
+		for _, line := range reader.lines {
+			if len(plainLines) >= _JsonDetectLineCount {
+				break
+			}
+			plainLines = append(plainLines, line.Plain(nil))
+		}
+		reader.Unlock()
+
+		decoder := json.NewDecoder(strings.NewReader(strings.Join(plainLines, "\n")))
+		for {
+			_, err := decoder.Token()
+			if err != nil {
+				// Running out of input is fine, that's why we're only checking
+				var syntaxError *json.SyntaxError
+				return !errors.As(err, &syntaxError)
+			}
+		}
+	}
+}
+
+// Wait until all input has been read. Returns false if the input was replaced
+// while waiting.
+func (reader *Reader) waitForDone() bool {
+	for {
+		reader.Lock()
+		done := reader.done.Load()
+		inputChanged := reader.inputChangedUnlocked()
+		replaced := reader.replaced
+		reader.Unlock()
+
+		if replaced {
+			return false
+		}
+		if done {
+			return true
+		}
+		<-inputChanged
+	}
+}
+
+// Wait for the first input line, and start showing the input as JSON if it
+// looks like JSON. Input with one JSON value per line is shown as JSON lines
+// right away. Otherwise we check that the first lines could be the start of a
+// JSON document, wait until all input has been read, and then try parsing it
+// as one JSON document.
+func (reader *Reader) detectJson(style chroma.Style, formatter chroma.Formatter) {
+	firstLine, found := reader.waitForFirstLine()
+	if !found {
+		return
+	}
+
+	if !reader.options.forceJson && !strings.HasPrefix(firstLine, "{") && !strings.HasPrefix(firstLine, "[") {
+		return
+	}
+	if !reader.options.forceJson && parseLogLine(firstLine) != nil {
+		// Log lines, see detectLog()
+		return
+	}
+
+	roots, err := parseJsonValues(firstLine)
+	if err == nil && len(roots) == 1 {
+		reader.Lock()
+		if !reader.replaced {
+			log.Debug("Showing input as JSON lines")
+			reader.json = &_JsonView{style: style, formatter: formatter}
+		}
+		reader.Unlock()
+		reader.signalMoreLinesAdded()
+		return
+	}
+
+	if !reader.mayBeJsonDocument() {
+		log.Debug("Not showing input as JSON, it doesn't start like a JSON document")
+		return
+	}
+	if !reader.waitForDone() {
+		return
+	}
+
+	reader.Lock()
+	plainLines := make([]string, 0, len(reader.lines))
+	for _, line := range reader.lines {
+		plainLines = append(plainLines, line.Plain(nil))
+	}
+	reader.Unlock()
+
+	roots, err = parseJsonValues(strings.Join(plainLines, "\n"))
+	if err != nil || len(roots) == 0 {
+		log.Debug("Not showing input as JSON: ", err)
+		return
+	}
+	view := newJsonDocumentView(roots, style, formatter)
+
+	reader.Lock()
+	if !reader.replaced {
+		log.Debug("Showing input as a JSON document")
+		reader.json = view
+	}
+	reader.Unlock()
+	reader.signalMoreLinesAdded()
+}
+
+func (r *Reader) isShowingJson() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.json != nil
+}
+
+// Fold or unfold the JSON on a line, see _JsonView.toggleFold(). Returns the
+// line number of the first line of what was folded or unfolded.
+func (r *Reader) toggleJsonFold(lineNumberOneBased int) int {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.json == nil || lineNumberOneBased < 1 || lineNumberOneBased > r.lineCountUnlocked() {
+		return lineNumberOneBased
+	}
+
+	lineIndex := r.unfilteredLineNumberUnlocked(lineNumberOneBased) - 1
+	toggled := r.json.toggleFold(lineIndex) + 1
+	if r.filter != nil {
+		// Folding changes which lines there are
+		r.updateFilterUnlocked()
+	}
+	return r.waitForFilteredLineNumberUnlocked(toggled)
+}
+
+// Fold or unfold all JSON, see _JsonView.foldAll()
+func (r *Reader) foldAllJson(folded bool, lineNumberOneBased int) int {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.json == nil {
+		return lineNumberOneBased
+	}
+
+	r.json.update(r.lines)
+	lineIndex := r.unfilteredLineNumberUnlocked(lineNumberOneBased) - 1
+	recordStart := r.json.foldAll(folded, lineIndex) + 1
+	if r.filter != nil {
+		// Folding changes which lines there are
+		r.updateFilterUnlocked()
+	}
+	return r.waitForFilteredLineNumberUnlocked(recordStart)
+}
+
+// Fold or unfold the JSON under the cursor
+func (p *Pager) toggleJsonFold() {
+	p.moveCursorTo(p.reader.toggleJsonFold(p.cursorLineOneBased()))
+}
+
+// Fold or unfold all JSON, keeping the cursor on the same record
+func (p *Pager) foldAllJson(folded bool) {
+	p.moveCursorTo(p.reader.foldAllJson(folded, p.cursorLineOneBased()))
+}
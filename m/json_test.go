@@ -0,0 +1,158 @@
+package m
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+// Read some text as a stream, and wait for it to be shown as JSON
+func jsonReader(t *testing.T, text string) *Reader {
+	return jsonReaderWithOptions(t, text, ReaderOptions{})
+}
+
+func jsonReaderWithOptions(t *testing.T, text string, options ReaderOptions) *Reader {
+	reader := NewHighlightingReaderFromStreamWithOptions("", strings.NewReader(text), *styles.Get("native"), formatters.TTY16m, options)
+	assert.NilError(t, reader._wait())
+
+	waitFor(t, "Input never shown as JSON", reader.isShowingJson)
+
+	return reader
+}
+
+func TestParseJsonKeepsOrderAndNumbers(t *testing.T) {
+	roots, err := parseJsonValues(`{"z": 1.50, "a": [true, null, "<\u001b>"]} [] 7`)
+	assert.NilError(t, err)
+	assert.Equal(t, len(roots), 3)
+	assert.Equal(t, roots[0].compact(), `{"z": 1.50, "a": [true, null, "<\u001b>"]}`)
+	assert.Equal(t, roots[1].compact(), `[]`)
+	assert.Equal(t, roots[2].compact(), `7`)
+
+	_, err = parseJsonValues(`{"a": 1`)
+	assert.Assert(t, err != nil)
+	_, err = parseJsonValues(`{"a": 1}}`)
+	assert.Assert(t, err != nil)
+}
+
+func TestJsonDocument(t *testing.T) {
+	reader := jsonReader(t, "{\"name\": \"moar\",\n\"tags\": [\"pager\", 1], \"empty\": {}}\n")
+
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		`{`,
+		`  "name": "moar",`,
+		`  "tags": [`,
+		`    "pager",`,
+		`    1`,
+		`  ],`,
+		`  "empty": {}`,
+		`}`,
+	})
+
+	// Colors from the Chroma JSON lexer
+	assert.Assert(t, strings.Contains(reader.GetLine(2).raw, "\x1b["), reader.GetLine(2).raw)
+
+	lines, _ := reader.GetLines(1, 1)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "[json]: "), lines.statusText)
+}
+
+func TestJsonLinesFolding(t *testing.T) {
+	reader := jsonReader(t, "{\"a\": {\"b\": 1}}\nnot JSON\n[2]\n")
+
+	// Records start out folded
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		`{"a": {"b": 1}}`,
+		`not JSON`,
+		`[2]`,
+	})
+
+	assert.Equal(t, reader.toggleJsonFold(1), 1)
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		`{`,
+		`  "a": {"b": 1}`,
+		`}`,
+		`not JSON`,
+		`[2]`,
+	})
+
+	assert.Equal(t, reader.toggleJsonFold(2), 2)
+	assert.Equal(t, reader.GetLineCount(), 7)
+
+	// Toggling a value folds the object it is in
+	assert.Equal(t, reader.toggleJsonFold(3), 2)
+	assert.Equal(t, reader.GetLine(2).Plain(nil), `  "a": {"b": 1}`)
+
+	// Lines that aren't JSON can't be folded
+	assert.Equal(t, reader.toggleJsonFold(4), 4)
+}
+
+func TestJsonFoldAll(t *testing.T) {
+	reader := jsonReader(t, "{\"a\": [1]}\n{\"b\": 2}\n")
+
+	// The cursor stays on the same record
+	assert.Equal(t, reader.foldAllJson(false, 2), 6)
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		`{`,
+		`  "a": [`,
+		`    1`,
+		`  ]`,
+		`}`,
+		`{`,
+		`  "b": 2`,
+		`}`,
+	})
+
+	assert.Equal(t, reader.foldAllJson(true, 7), 2)
+	assert.DeepEqual(t, readLines(t, reader), []string{`{"a": [1]}`, `{"b": 2}`})
+}
+
+func TestJsonPagerKeys(t *testing.T) {
+	reader := jsonReader(t, "{\"a\": 1}\n{\"b\": 2}\n")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+
+	pager.onRune('j')
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.cursorLineOneBased(), 2)
+	assert.Equal(t, reader.GetLine(3).Plain(nil), `  "b": 2`)
+
+	pager.onRune('-')
+	assert.Equal(t, reader.GetLineCount(), 2)
+	assert.Equal(t, pager.cursorLineOneBased(), 2)
+}
+
+func TestNotJson(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("{ not json\n"))
+	assert.NilError(t, reader._wait())
+
+	// Returns when detection is done
+	reader.detectJson(*styles.Get("native"), formatters.TTY16m)
+	assert.Assert(t, !reader.isShowingJson())
+	assert.DeepEqual(t, readLines(t, reader), []string{"{ not json"})
+}
+
+func TestNotJsonDocument(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+
+	reader := NewReaderFromStream("", pipeReader)
+	go func() {
+		_, _ = pipeWriter.Write([]byte("[section]\n" + strings.Repeat("key=value\n", _JsonDetectLineCount)))
+	}()
+
+	// Gives up without waiting for the rest of the input
+	var detected atomic.Bool
+	go func() {
+		reader.detectJson(*styles.Get("native"), formatters.TTY16m)
+		detected.Store(true)
+	}()
+	waitFor(t, "JSON detection never gave up", detected.Load)
+	assert.Assert(t, !reader.isShowingJson())
+	assert.Assert(t, !reader.done.Load())
+}
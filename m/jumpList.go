@@ -0,0 +1,60 @@
+package m
+
+// How many positions to remember for CTRL-o / CTRL-i
+const _MaxJumps = 100
+
+// Remember where we are before jumping somewhere else, so that we can get back
+// here using CTRL-o, like in vim.
+//
+// Call this for longer jumps like searching and going to some line, not for
+// plain scrolling.
+func (p *Pager) pushJump() {
+	// Going somewhere new forgets the positions we have stepped back from
+	p.jumps = append(p.jumps[:p.jumpIndex], p.currentMark())
+
+	if len(p.jumps) > _MaxJumps {
+		p.jumps = p.jumps[len(p.jumps)-_MaxJumps:]
+	}
+	p.jumpIndex = len(p.jumps)
+}
+
+// Step back (delta -1) or forward (delta 1) in the jump list. Positions in
+// other files, and positions at the line we're already on, are skipped.
+func (p *Pager) stepJumps(delta int) {
+	if delta < 0 && p.jumpIndex == len(p.jumps) {
+		// Make it possible to come back here using CTRL-i
+		p.pushJump()
+		p.jumpIndex--
+	}
+
+	currentLine := p.lineNumberOneBased()
+	for index := p.jumpIndex + delta; index >= 0 && index < len(p.jumps); index += delta {
+		jump := p.jumps[index]
+		if jump.reader == p.reader && p.markLineNumber(jump) == currentLine {
+			continue
+		}
+
+		if jump.reader == p.reader || jump.reader == p.tailPreviewSource {
+			p.jumpIndex = index
+			p.goToMark(jump)
+			return
+		}
+	}
+
+	if delta < 0 {
+		p.message = "No earlier position to go back to"
+	} else {
+		p.message = "No later position to go forward to"
+	}
+}
+
+// Scroll to a mark or a jump list position in the current Reader
+func (p *Pager) goToMark(mark _Mark) {
+	if mark.reader != p.reader {
+		// Marked before we started previewing the end of the file
+		p.endTailPreview()
+	}
+
+	p.handleScrolledUp()
+	p.scrollToUnfilteredLine(p.reader.unfilteredLineNumberOf(mark.position))
+}
@@ -0,0 +1,148 @@
+package m
+
+import (
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func jumpListPager() *Pager {
+	pager := NewPager(numberedReader(100))
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+	return pager
+}
+
+func typeGotoLine(pager *Pager, lineNumber string) {
+	pager.onRune('g')
+	for _, char := range lineNumber {
+		pager.onRune(char)
+	}
+	pager.onKey(twin.KeyEnter)
+}
+
+func TestJumpToMark(t *testing.T) {
+	pager := jumpListPager()
+
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(42, "TestJumpToMark")
+	pager.onRune('m')
+	pager.onRune('a')
+
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(7, "TestJumpToMark")
+	pager.onRune('\'')
+	pager.onRune('a')
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.Equal(t, pager.lineNumberOneBased(), 42)
+
+	// '' goes back to where we jumped from
+	pager.onRune('\'')
+	pager.onRune('\'')
+	assert.Equal(t, pager.lineNumberOneBased(), 7)
+
+	pager.onRune('\'')
+	pager.onRune('b')
+	assert.Equal(t, pager.message, "No mark 'b' in this file")
+	assert.Equal(t, pager.lineNumberOneBased(), 7)
+}
+
+func TestJumpList(t *testing.T) {
+	pager := jumpListPager()
+
+	typeGotoLine(pager, "20")
+	assert.Equal(t, pager.lineNumberOneBased(), 20)
+
+	// Search hits after line 20 are on lines 50 and 70
+	pager.onRune('/')
+	for _, char := range "line [57]0$" {
+		pager.onRune(char)
+	}
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+	pager.onRune('n')
+	assert.Equal(t, pager.lineNumberOneBased(), 70)
+
+	// CTRL-o goes back
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.lineNumberOneBased(), 20)
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.message, "No earlier position to go back to")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	// CTRL-i goes forward again
+	pager.onRune('\t')
+	assert.Equal(t, pager.lineNumberOneBased(), 20)
+	pager.onRune('\t')
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+	pager.onRune('\t')
+	assert.Equal(t, pager.lineNumberOneBased(), 70)
+	pager.onRune('\t')
+	assert.Equal(t, pager.message, "No later position to go forward to")
+
+	// Going somewhere new forgets what we stepped back from
+	pager.onRune('\x0f')
+	typeGotoLine(pager, "30")
+	pager.onRune('\t')
+	assert.Equal(t, pager.message, "No later position to go forward to")
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+}
+
+func TestJumpBackFromEnd(t *testing.T) {
+	pager := jumpListPager()
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(10, "TestJumpBackFromEnd")
+
+	pager.onRune('G')
+	pager.redraw("")
+	assert.Assert(t, pager.lineNumberOneBased() > 90)
+
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.lineNumberOneBased(), 10)
+
+	// Not following the end of the input any more
+	assert.Equal(t, pager.TargetLineNumberOneBased, 0)
+}
+
+func TestMarkWhenFiltering(t *testing.T) {
+	pager := NewPager(numberedReader(100))
+	pager.screen = twin.NewFakeScreen(80, 5)
+	pager.redraw("")
+
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(42, "TestMarkWhenFiltering")
+	pager.onRune('m')
+	pager.onRune('a')
+
+	// Line 42 is the fifth one ending with a 2
+	typeFilter(pager, "2$")
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(1, "TestMarkWhenFiltering")
+	pager.onRune('\'')
+	pager.onRune('a')
+	assert.Equal(t, pager.lineNumberOneBased(), 5)
+	assert.Equal(t, pager.reader.displayLineNumber(5), 42)
+
+	// Back where we were, and then to line 42 again without the filter
+	pager.onRune('\x0f')
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	typeFilter(pager, "")
+	pager.onRune('\t')
+	assert.Equal(t, pager.lineNumberOneBased(), 42)
+}
+
+func TestMarkWhenFoldingJson(t *testing.T) {
+	reader := jsonReader(t, "{\"a\": [1]}\n{\"b\": 2}\n")
+	reader.foldAllJson(false, 1)
+	assert.Equal(t, reader.GetLine(7).Plain(nil), `  "b": 2`)
+	position := reader.inputPosition(7)
+
+	reader.toggleJsonFold(1)
+	assert.Equal(t, reader.unfilteredLineNumberOf(position), 3)
+	assert.Equal(t, reader.GetLine(3).Plain(nil), `  "b": 2`)
+
+	// Folded away, go to the record instead
+	reader.foldAllJson(true, 1)
+	assert.Equal(t, reader.unfilteredLineNumberOf(position), 2)
+}
@@ -0,0 +1,234 @@
+package m
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Runs a callback once the wrapped stream reports EOF or some other error, or
+// when end() is called, whichever happens first
+type _OnEndReader struct {
+	stream io.Reader
+	onEnd  func()
+	once   sync.Once
+}
+
+func (r *_OnEndReader) Read(p []byte) (int, error) {
+	n, err := r.stream.Read(p)
+	if err != nil {
+		r.end()
+	}
+	return n, err
+}
+
+func (r *_OnEndReader) end() {
+	r.once.Do(r.onEnd)
+}
+
+// Creates a command for running a command line through the system shell
+func shellCommand(commandLine string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", commandLine)
+	}
+	return exec.Command("sh", "-c", commandLine)
+}
+
+// Quote a string for inclusion in a shell command line
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return cmdQuote(s)
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Quote a string for inclusion in a cmd.exe command line. Doubling embedded
+// quotes keeps cmd.exe from ending the quoted part early, and programs read
+// the doubled quotes as one.
+func cmdQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// Replace each "%s" in a LESSOPEN / LESSCLOSE command line with the next
+// filename, quoted for the shell.
+func expandLessOpenCommand(commandLine string, filenames ...string) string {
+	expanded := strings.Builder{}
+	for {
+		index := strings.Index(commandLine, "%s")
+		if index < 0 {
+			expanded.WriteString(commandLine)
+			return expanded.String()
+		}
+
+		expanded.WriteString(commandLine[:index])
+		if len(filenames) > 0 {
+			expanded.WriteString(shellQuote(filenames[0]))
+			filenames = filenames[1:]
+		}
+		commandLine = commandLine[index+2:]
+	}
+}
+
+// Run the LESSCLOSE postprocessor (if any) after we're done with a LESSOPEN
+// preprocessed file.
+//
+// For the pipe form of LESSOPEN, replacementFilename should be "-".
+func runLessClose(originalFilename string, replacementFilename string) {
+	lessClose := os.Getenv("LESSCLOSE")
+	if lessClose == "" {
+		return
+	}
+
+	commandLine := expandLessOpenCommand(lessClose, originalFilename, replacementFilename)
+	output, err := shellCommand(commandLine).CombinedOutput()
+	if err != nil {
+		log.Warnf("LESSCLOSE postprocessor <%s> failed: %s: %s",
+			commandLine, err, strings.TrimSpace(string(output)))
+	}
+}
+
+// Run a file through the LESSOPEN input preprocessor, just like less does.
+//
+// Returns nil with no error if there is no LESSOPEN preprocessor, or if the
+// preprocessor didn't want to handle this file.
+//
+// Ref: https://man7.org/linux/man-pages/man1/less.1.html#INPUT_PREPROCESSOR
+func newReaderFromLessOpen(filename string, options ReaderOptions) (*Reader, error) {
+	lessOpen := os.Getenv("LESSOPEN")
+	if lessOpen == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(lessOpen, "|") {
+		lessOpen = strings.TrimPrefix(lessOpen, "|")
+
+		// With two pipes, an empty output with a zero exit code means the
+		// file really is empty.
+		emptyIsValid := strings.HasPrefix(lessOpen, "|")
+		lessOpen = strings.TrimPrefix(lessOpen, "|")
+
+		// A leading "-" means the preprocessor should also be used for
+		// stdin, but we only ever run it on named files.
+		lessOpen = strings.TrimPrefix(lessOpen, "-")
+
+		return newReaderFromLessOpenPipe(filename, lessOpen, emptyIsValid, options)
+	}
+
+	return newReaderFromLessOpenFile(filename, lessOpen, options)
+}
+
+// The LESSOPEN pipe form: "|lesspipe.sh %s". The preprocessor writes the
+// contents to show to stdout.
+func newReaderFromLessOpenPipe(filename string, lessOpen string, emptyIsValid bool, options ReaderOptions) (*Reader, error) {
+	commandLine := expandLessOpenCommand(lessOpen, filename)
+	filter := shellCommand(commandLine)
+	filterOut, filterErr, err := startFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("starting LESSOPEN preprocessor <%s>: %w", commandLine, err)
+	}
+
+	// Check whether we got any output before deciding what to show
+	bufferedOut := bufio.NewReader(filterOut)
+	_, peekErr := bufferedOut.Peek(1)
+	if peekErr == nil {
+		onEnd := &_OnEndReader{
+			stream: bufferedOut,
+			onEnd:  func() { runLessClose(filename, "-") },
+		}
+		reader := newReaderFromFilter(filename, filter, onEnd, filterErr, options)
+		reader.Lock()
+		reader.onRelease = onEnd.end
+		reader.Unlock()
+		return reader, nil
+	}
+
+	// No output
+	stderrText := ""
+	if filterErr != nil {
+		stderrBytes, err := io.ReadAll(filterErr)
+		if err != nil {
+			log.Warn("Draining LESSOPEN preprocessor stderr failed: ", err)
+		}
+		stderrText = strings.TrimSpace(string(stderrBytes))
+	}
+	waitErr := filter.Wait()
+	runLessClose(filename, "-")
+
+	if emptyIsValid {
+		if waitErr != nil {
+			log.Debugf("LESSOPEN preprocessor <%s> failed, showing original file: %s", commandLine, waitErr)
+			return nil, nil
+		}
+
+		emptyReader := newReaderFromStream(strings.NewReader(""), nil, nil, options)
+		emptyReader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+		emptyReader.Lock()
+		emptyReader.name = &filename
+		emptyReader.Unlock()
+		return emptyReader, nil
+	}
+
+	if waitErr != nil && stderrText != "" {
+		return nil, fmt.Errorf("LESSOPEN preprocessor <%s> failed: %s: %w", commandLine, stderrText, waitErr)
+	}
+
+	log.Debugf("LESSOPEN preprocessor <%s> printed nothing, showing original file", commandLine)
+	return nil, nil
+}
+
+// The LESSOPEN temp file form: "lessopen.sh %s". The preprocessor prints the
+// name of a replacement file to show, and LESSCLOSE is responsible for removing
+// that replacement file after we're done with it.
+func newReaderFromLessOpenFile(filename string, lessOpen string, options ReaderOptions) (*Reader, error) {
+	commandLine := expandLessOpenCommand(lessOpen, filename)
+	output, err := shellCommand(commandLine).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("LESSOPEN preprocessor <%s> failed: %s: %w",
+				commandLine, strings.TrimSpace(string(exitErr.Stderr)), err)
+		}
+		return nil, fmt.Errorf("LESSOPEN preprocessor <%s> failed: %w", commandLine, err)
+	}
+
+	replacementFilename := strings.TrimSpace(string(output))
+	if replacementFilename == "" {
+		log.Debugf("LESSOPEN preprocessor <%s> printed no replacement file name, showing original file", commandLine)
+		return nil, nil
+	}
+
+	stream, err := os.Open(replacementFilename)
+	if err != nil {
+		runLessClose(filename, replacementFilename)
+		return nil, fmt.Errorf("opening LESSOPEN replacement file: %w", err)
+	}
+
+	onEnd := &_OnEndReader{
+		stream: stream,
+		onEnd: func() {
+			err := stream.Close()
+			if err != nil {
+				log.Warn("Error closing LESSOPEN replacement file: ", err)
+			}
+			runLessClose(filename, replacementFilename)
+		},
+	}
+
+	// No line counting, that would read the replacement file in the
+	// background, while LESSCLOSE could be removing it
+	reader := newReaderFromStream(onEnd, nil, nil, options)
+	reader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+	reader.Lock()
+	reader.name = &filename
+	reader.onRelease = onEnd.end
+	reader.Unlock()
+	return reader, nil
+}
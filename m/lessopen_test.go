@@ -0,0 +1,122 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+func readFirstLine(t *testing.T, filename string) (string, error) {
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	if err != nil {
+		return "", err
+	}
+	if err := reader._wait(); err != nil {
+		return "", err
+	}
+
+	lines, _ := reader.GetLines(1, 1)
+	if len(lines.lines) == 0 {
+		return "", nil
+	}
+	return lines.lines[0].Plain(nil), nil
+}
+
+func createHejFile(t *testing.T) string {
+	filename := t.TempDir() + "/hej.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("hej\n"), 0o600))
+	return filename
+}
+
+func TestExpandLessOpenCommand(t *testing.T) {
+	assert.Equal(t, expandLessOpenCommand("lesspipe %s", "a b"), "lesspipe 'a b'")
+	assert.Equal(t, expandLessOpenCommand("close %s %s", "a", "-"), "close 'a' '-'")
+	assert.Equal(t, expandLessOpenCommand("quote %s", "it's"), `quote 'it'\''s'`)
+	assert.Equal(t, expandLessOpenCommand("none"), "none")
+
+	assert.Equal(t, cmdQuote(`say "hi"`), `"say ""hi"""`)
+}
+
+func TestLessOpenPipe(t *testing.T) {
+	t.Setenv("LESSOPEN", "|tr a-z A-Z < %s")
+	t.Setenv("LESSCLOSE", "")
+
+	firstLine, err := readFirstLine(t, createHejFile(t))
+	assert.NilError(t, err)
+	assert.Equal(t, firstLine, "HEJ")
+}
+
+func TestLessOpenPipeNoOutput(t *testing.T) {
+	// Without any output we should fall back to showing the original file
+	t.Setenv("LESSOPEN", "|true %s")
+	t.Setenv("LESSCLOSE", "")
+
+	firstLine, err := readFirstLine(t, createHejFile(t))
+	assert.NilError(t, err)
+	assert.Equal(t, firstLine, "hej")
+}
+
+func TestLessOpenDoublePipeNoOutput(t *testing.T) {
+	// Empty output plus a zero exit code means the file should be empty
+	t.Setenv("LESSOPEN", "||true %s")
+	t.Setenv("LESSCLOSE", "")
+
+	firstLine, err := readFirstLine(t, createHejFile(t))
+	assert.NilError(t, err)
+	assert.Equal(t, firstLine, "")
+
+	// Non-zero exit code means we should show the original file
+	t.Setenv("LESSOPEN", "||false %s")
+	firstLine, err = readFirstLine(t, createHejFile(t))
+	assert.NilError(t, err)
+	assert.Equal(t, firstLine, "hej")
+}
+
+func TestLessOpenPipeFailure(t *testing.T) {
+	t.Setenv("LESSOPEN", "|echo Preprocessing failed %s >&2; exit 1")
+	t.Setenv("LESSCLOSE", "")
+
+	_, err := readFirstLine(t, createHejFile(t))
+	assert.ErrorContains(t, err, "Preprocessing failed")
+}
+
+func TestLessOpenTempFile(t *testing.T) {
+	tempDir := t.TempDir()
+	replacement := tempDir + "/replacement.txt"
+	assert.NilError(t, os.WriteFile(replacement, []byte("Replaced!\n"), 0o600))
+	closeLog := tempDir + "/closed.txt"
+
+	t.Setenv("LESSOPEN", "echo "+replacement+" ; true %s")
+	t.Setenv("LESSCLOSE", "echo %s %s > "+closeLog)
+
+	original := createHejFile(t)
+	firstLine, err := readFirstLine(t, original)
+	assert.NilError(t, err)
+	assert.Equal(t, firstLine, "Replaced!")
+
+	closed, err := os.ReadFile(closeLog)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(closed)), original+" "+replacement)
+}
+
+func TestLessCloseOnRelease(t *testing.T) {
+	closeLog := t.TempDir() + "/closed.txt"
+
+	// Still running when we're done with it
+	t.Setenv("LESSOPEN", "|echo Preprocessed; sleep 2; true %s")
+	t.Setenv("LESSCLOSE", "echo %s %s > "+closeLog)
+
+	original := createHejFile(t)
+	reader, err := NewReaderFromFilename(original, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	waitForLines(t, reader, "Preprocessed")
+
+	reader.release()
+	closed, err := os.ReadFile(closeLog)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(closed)), original+" -")
+}
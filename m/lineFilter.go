@@ -0,0 +1,347 @@
+package m
+
+import (
+	"math"
+	"regexp"
+	"sort"
+)
+
+// How many lines to check at a time, see Reader.updateFilterLinesUnlocked()
+const _FilterChunkSize = 1000
+
+// Shows only some of the lines of a Reader. The lines keep the line numbers
+// they have in the unfiltered input.
+type _LineFilter struct {
+	// Called with the Reader locked
+	accepts func(lineIndex int) bool
+
+	// Show this many lines around accepted lines, like "grep -C"
+	context int
+
+	lines []_FilteredLine
+
+	// Number of unfiltered lines checked so far
+	checkedCount int
+
+	// Indexes of the last accepted and the last shown unfiltered lines, -1
+	// for none
+	lastAccepted int
+	lastShown    int
+
+	// What we looked like before checking the last line, for checking it
+	// again if it was the last input line. Following may complete it later.
+	beforeLast  _LineFilterState
+	recheckLast bool
+
+	// Set while filterInBackground() is checking lines
+	filtering bool
+}
+
+// A line shown by a _LineFilter
+type _FilteredLine struct {
+	// Index among the unfiltered lines, -1 for separators between groups of
+	// context lines that don't touch
+	index int
+
+	// False for context lines
+	accepted bool
+}
+
+type _LineFilterState struct {
+	lineCount    int
+	lastAccepted int
+	lastShown    int
+}
+
+// Shown between groups of lines that don't touch, like in grep output
+var _FilterSeparator = NewLine("--")
+
+func newLineFilter(accepts func(lineIndex int) bool, context int) *_LineFilter {
+	return &_LineFilter{
+		accepts:      accepts,
+		context:      context,
+		lastAccepted: -1,
+		lastShown:    -1,
+	}
+}
+
+func (filter *_LineFilter) state() _LineFilterState {
+	return _LineFilterState{
+		lineCount:    len(filter.lines),
+		lastAccepted: filter.lastAccepted,
+		lastShown:    filter.lastShown,
+	}
+}
+
+func (filter *_LineFilter) restore(state _LineFilterState) {
+	filter.lines = filter.lines[:state.lineCount]
+	filter.lastAccepted = state.lastAccepted
+	filter.lastShown = state.lastShown
+}
+
+// Check at most maxCount lines we haven't checked yet. Returns true if all
+// lines have been checked.
+func (filter *_LineFilter) update(unfilteredCount int, maxCount int) bool {
+	if unfilteredCount < filter.checkedCount {
+		// Lines went away, start over
+		filter.restore(_LineFilterState{lineCount: 0, lastAccepted: -1, lastShown: -1})
+		filter.checkedCount = 0
+		filter.recheckLast = false
+	}
+
+	if filter.recheckLast {
+		// Check the last line again, following may have completed it since
+		filter.restore(filter.beforeLast)
+		filter.checkedCount--
+	}
+
+	end := unfilteredCount
+	if end-filter.checkedCount > maxCount {
+		end = filter.checkedCount + maxCount
+	}
+
+	for lineIndex := filter.checkedCount; lineIndex < end; lineIndex++ {
+		filter.beforeLast = filter.state()
+
+		if filter.accepts(lineIndex) {
+			first := lineIndex - filter.context
+			if first <= filter.lastShown {
+				first = filter.lastShown + 1
+			} else if filter.context > 0 && filter.lastShown >= 0 {
+				filter.lines = append(filter.lines, _FilteredLine{index: -1})
+			}
+
+			for contextIndex := first; contextIndex < lineIndex; contextIndex++ {
+				filter.lines = append(filter.lines, _FilteredLine{index: contextIndex})
+			}
+			filter.lines = append(filter.lines, _FilteredLine{index: lineIndex, accepted: true})
+			filter.lastAccepted = lineIndex
+			filter.lastShown = lineIndex
+		} else if filter.lastAccepted >= 0 && lineIndex-filter.lastAccepted <= filter.context {
+			filter.lines = append(filter.lines, _FilteredLine{index: lineIndex})
+			filter.lastShown = lineIndex
+		}
+	}
+	filter.checkedCount = end
+	filter.recheckLast = end > 0 && end == unfilteredCount
+
+	return end == unfilteredCount
+}
+
+// Check some more lines against our filter. If there are too many to check
+// without making the UI wait, the rest are checked in the background.
+func (r *Reader) updateFilterLinesUnlocked() {
+	if r.filter.update(r.unfilteredLineCountUnlocked(), _FilterChunkSize) {
+		return
+	}
+
+	if r.filter.filtering {
+		return
+	}
+	r.filter.filtering = true
+	go r.filterInBackground(r.filter)
+}
+
+// Check lines one chunk at a time, letting others at the Reader in between.
+// Gives up if the filter gets replaced.
+func (r *Reader) filterInBackground(filter *_LineFilter) {
+	for {
+		r.Lock()
+		if r.filter != filter {
+			r.Unlock()
+			return
+		}
+		done := filter.update(r.unfilteredLineCountUnlocked(), _FilterChunkSize)
+		if done {
+			filter.filtering = false
+		}
+		r.Unlock()
+
+		// Show what we have so far
+		select {
+		case r.moreLinesAdded <- true:
+		default:
+		}
+
+		if done {
+			return
+		}
+	}
+}
+
+// Are we still checking lines against our filter in the background?
+func (r *Reader) isFiltering() bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.filter != nil && r.filter.filtering
+}
+
+// Set up the filter from the current filtering settings, or remove it if
+// nothing should be filtered out
+func (r *Reader) updateFilterUnlocked() {
+	minLevel := _LogLevelNone
+	if r.logView != nil {
+		minLevel = r.logView.minLevel
+	}
+
+	if minLevel == _LogLevelNone && r.filterPattern == nil {
+		r.filter = nil
+		return
+	}
+
+	context := r.filterContext
+	if r.filterPattern == nil {
+		context = 0
+	}
+
+	r.filter = newLineFilter(
+		func(lineIndex int) bool {
+			if minLevel != _LogLevelNone && r.logView.level(r.lines, lineIndex) < minLevel {
+				return false
+			}
+
+			if r.filterPattern != nil {
+				plain := r.unfilteredLineUnlocked(lineIndex).Plain(nil)
+				if r.filterPattern.MatchString(plain) == r.filterInverted {
+					return false
+				}
+			}
+
+			return true
+		},
+		context)
+}
+
+// The line number some line has in the unfiltered input, 0 for separators
+func (r *Reader) unfilteredLineNumber(lineNumberOneBased int) int {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.unfilteredLineNumberUnlocked(lineNumberOneBased)
+}
+
+func (r *Reader) unfilteredLineNumberUnlocked(lineNumberOneBased int) int {
+	if r.filter == nil {
+		return lineNumberOneBased
+	}
+
+	r.lineCountUnlocked() // Updates the filter
+	if lineNumberOneBased < 1 || lineNumberOneBased > len(r.filter.lines) {
+		return lineNumberOneBased
+	}
+	return r.filter.lines[lineNumberOneBased-1].index + 1
+}
+
+// A line from before filtering, nil if there's no such line
+func (r *Reader) unfilteredLine(lineNumberOneBased int) *Line {
+	r.Lock()
+	defer r.Unlock()
+
+	if lineNumberOneBased < 1 || lineNumberOneBased > r.unfilteredLineCountUnlocked() {
+		return nil
+	}
+	return r.unfilteredLineUnlocked(lineNumberOneBased - 1)
+}
+
+// The line number of the first shown line at or after an unfiltered line
+// number, or of the last shown line if there is none.
+//
+// Returns false if our filter hasn't checked enough lines to know yet.
+func (r *Reader) filteredLineNumber(unfilteredLineNumberOneBased int) (int, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.filteredLineNumberUnlocked(unfilteredLineNumberOneBased)
+}
+
+func (r *Reader) filteredLineNumberUnlocked(unfilteredLineNumberOneBased int) (int, bool) {
+	if r.filter == nil {
+		return unfilteredLineNumberOneBased, true
+	}
+
+	r.lineCountUnlocked() // Updates the filter
+	lines := r.filter.lines
+	found := sort.Search(len(lines), func(i int) bool {
+		if lines[i].index < 0 {
+			// Separators are always followed by a line
+			i++
+		}
+		return lines[i].index >= unfilteredLineNumberOneBased-1
+	})
+	if found < len(lines) && lines[found].index < 0 {
+		found++
+	}
+	if found >= len(lines) {
+		found = len(lines) - 1
+		if r.filter.checkedCount < r.unfilteredLineCountUnlocked() {
+			// Something further down may still be shown
+			return found + 1, false
+		}
+	}
+	return found + 1, true
+}
+
+// Like filteredLineNumberUnlocked(), but checks lines until we know
+func (r *Reader) waitForFilteredLineNumberUnlocked(unfilteredLineNumberOneBased int) int {
+	for {
+		lineNumber, known := r.filteredLineNumberUnlocked(unfilteredLineNumberOneBased)
+		if known {
+			return lineNumber
+		}
+		r.filter.update(r.unfilteredLineCountUnlocked(), _FilterChunkSize)
+	}
+}
+
+// Whether a line was accepted by our filter, or is context or a separator.
+// Without any filter all lines are accepted.
+func (r *Reader) filteredLine(lineNumberOneBased int) _FilteredLine {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.filter == nil || lineNumberOneBased < 1 || lineNumberOneBased > len(r.filter.lines) {
+		return _FilteredLine{index: lineNumberOneBased - 1, accepted: true}
+	}
+	return r.filter.lines[lineNumberOneBased-1]
+}
+
+// The pattern to highlight in accepted lines, nil if there's nothing to
+// highlight
+func (r *Reader) filterHighlightPattern() *regexp.Regexp {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.filterInverted {
+		return nil
+	}
+	return r.filterPattern
+}
+
+// Change how lines are filtered, staying at the same input line
+func (p *Pager) refilter(change func()) {
+	unfilteredLineNumber := p.reader.unfilteredLineNumber(p.lineNumberOneBased())
+
+	change()
+
+	p.scrollToUnfilteredLine(unfilteredLineNumber)
+	if p.TargetLineNumberOneBased != math.MaxInt {
+		// Line numbers mean something else now, but keep following if we were
+		p.TargetLineNumberOneBased = 0
+	}
+}
+
+// Scroll to the first shown line at or after some unfiltered line. If our
+// filter hasn't got that far yet, we go there once it has, see
+// pendingUnfilteredLineNumber.
+func (p *Pager) scrollToUnfilteredLine(unfilteredLineNumberOneBased int) {
+	lineNumber, known := p.reader.filteredLineNumber(unfilteredLineNumberOneBased)
+	p.pendingUnfilteredLineNumber = 0
+	if !known {
+		p.pendingUnfilteredLineNumber = unfilteredLineNumberOneBased
+	}
+
+	if lineNumber < 1 {
+		lineNumber = 1
+	}
+	p.scrollPosition = NewScrollPositionFromLineNumberOneBased(lineNumber, "scrollToUnfilteredLine")
+}
@@ -0,0 +1,487 @@
+package m
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type _LogLevel int
+
+const (
+	// Lines without a level of their own, like stack traces
+	_LogLevelNone _LogLevel = iota
+
+	_LogLevelTrace
+	_LogLevelDebug
+	_LogLevelInfo
+	_LogLevelWarn
+	_LogLevelError
+	_LogLevelFatal
+)
+
+func (level _LogLevel) String() string {
+	switch level {
+	case _LogLevelTrace:
+		return "TRACE"
+	case _LogLevelDebug:
+		return "DEBUG"
+	case _LogLevelInfo:
+		return "INFO"
+	case _LogLevelWarn:
+		return "WARN"
+	case _LogLevelError:
+		return "ERROR"
+	case _LogLevelFatal:
+		return "FATAL"
+	}
+	return ""
+}
+
+// SGR sequences for showing the level, and for the message at this level
+func (level _LogLevel) colors() (string, string) {
+	switch level {
+	case _LogLevelTrace, _LogLevelDebug:
+		return "\x1b[2m", "\x1b[2m"
+	case _LogLevelInfo:
+		return "\x1b[32m", ""
+	case _LogLevelWarn:
+		return "\x1b[1;33m", "\x1b[33m"
+	case _LogLevelError:
+		return "\x1b[1;31m", "\x1b[31m"
+	case _LogLevelFatal:
+		return "\x1b[1;7;31m", "\x1b[1;31m"
+	}
+	return "", ""
+}
+
+// One parsed log line
+type _LogRecord struct {
+	time    string
+	level   _LogLevel
+	message string
+
+	// Everything else, as "key=value" strings
+	fields []string
+}
+
+// A log line, parsed when first needed
+type _LogLine struct {
+	// The input line this was parsed from
+	source *Line
+
+	// The level of this line, or of the line before for lines without one
+	level _LogLevel
+
+	// True if the level was in this line
+	hasLevel bool
+
+	formatted *Line
+}
+
+// Input shown as structured log lines, in logfmt or JSON
+type _LogView struct {
+	// Parsed lines, nil for lines not parsed yet
+	lines []*_LogLine
+
+	// Lines below this level are hidden, _LogLevelNone shows all lines
+	minLevel _LogLevel
+}
+
+var _LogLevelKeys = []string{"level", "lvl", "severity", "loglevel", "log.level"}
+var _LogTimeKeys = []string{"time", "ts", "timestamp", "@timestamp", "t", "datetime"}
+var _LogMessageKeys = []string{"msg", "message", "@message"}
+
+func isOneOf(s string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if strings.EqualFold(s, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLogLevel(name string) _LogLevel {
+	switch strings.ToLower(name) {
+	case "trace", "trc", "finest", "finer":
+		return _LogLevelTrace
+	case "debug", "dbg", "fine", "verbose":
+		return _LogLevelDebug
+	case "info", "inf", "information", "notice":
+		return _LogLevelInfo
+	case "warn", "warning", "wrn":
+		return _LogLevelWarn
+	case "error", "err", "eror":
+		return _LogLevelError
+	case "fatal", "ftl", "crit", "critical", "panic", "alert", "emerg", "emergency":
+		return _LogLevelFatal
+	}
+	return _LogLevelNone
+}
+
+// Numeric levels, as used by Bunyan and Pino
+func numericLogLevel(number float64) _LogLevel {
+	switch {
+	case number >= 60:
+		return _LogLevelFatal
+	case number >= 50:
+		return _LogLevelError
+	case number >= 40:
+		return _LogLevelWarn
+	case number >= 30:
+		return _LogLevelInfo
+	case number >= 20:
+		return _LogLevelDebug
+	}
+	return _LogLevelTrace
+}
+
+// Split a logfmt line, like `level=info msg="hello there"`, into keys and
+// values. Returns nil if this isn't logfmt.
+func parseLogfmt(line string) [][2]string {
+	pairs := [][2]string{}
+	runes := []rune(strings.TrimSpace(line))
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		keyStart := i
+		for i < len(runes) && runes[i] != '=' && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		if i == keyStart || i >= len(runes) || runes[i] != '=' {
+			// Not "key=", so not logfmt
+			return nil
+		}
+		key := string(runes[keyStart:i])
+		i++
+
+		valueStart := i
+		if i < len(runes) && runes[i] == '"' {
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(runes) {
+				// Unterminated quote
+				return nil
+			}
+			i++
+
+			value, err := strconv.Unquote(string(runes[valueStart:i]))
+			if err != nil {
+				value = string(runes[valueStart+1 : i-1])
+			}
+			pairs = append(pairs, [2]string{key, value})
+			continue
+		}
+
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		pairs = append(pairs, [2]string{key, string(runes[valueStart:i])})
+	}
+
+	return pairs
+}
+
+// Parse a logfmt or JSON log line. Returns nil for lines without a level.
+func parseLogLine(line string) *_LogRecord {
+	record := _LogRecord{}
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		roots, err := parseJsonValues(line)
+		if err != nil || len(roots) != 1 || roots[0].opening != "{" {
+			return nil
+		}
+
+		for _, member := range roots[0].children {
+			// Strings without their quotes, everything else as JSON
+			value := member.compact()
+			var stringValue string
+			if json.Unmarshal([]byte(value), &stringValue) == nil {
+				value = stringValue
+			}
+
+			record.add(*member.key, value, member.scalar)
+		}
+	} else {
+		pairs := parseLogfmt(line)
+		for _, pair := range pairs {
+			record.add(pair[0], pair[1], "")
+		}
+	}
+
+	if record.level == _LogLevelNone {
+		return nil
+	}
+	return &record
+}
+
+// Add a key and a value to a record. Set jsonNumber for numbers in JSON log
+// lines.
+func (record *_LogRecord) add(key string, value string, jsonNumber string) {
+	if record.level == _LogLevelNone && isOneOf(key, _LogLevelKeys) {
+		level := parseLogLevel(value)
+		if number, err := strconv.ParseFloat(jsonNumber, 64); err == nil {
+			level = numericLogLevel(number)
+		}
+		if level != _LogLevelNone {
+			record.level = level
+			return
+		}
+	}
+
+	if record.time == "" && isOneOf(key, _LogTimeKeys) {
+		record.time = value
+		return
+	}
+
+	if record.message == "" && isOneOf(key, _LogMessageKeys) {
+		record.message = value
+		return
+	}
+
+	if strings.ContainsAny(value, " \"=") {
+		value = strconv.Quote(value)
+	}
+	record.fields = append(record.fields, key+"="+value)
+}
+
+// Format as "time LEVEL message key=value...", colored by level
+func (record *_LogRecord) format() string {
+	levelColor, messageColor := record.level.colors()
+
+	// Keep ANSI sequences in the input from messing up our formatting
+	clean := func(s string) string {
+		return strings.ReplaceAll(s, "\x1b", "?")
+	}
+
+	builder := strings.Builder{}
+	if record.time != "" {
+		builder.WriteString("\x1b[2m" + clean(record.time) + "\x1b[m ")
+	}
+	builder.WriteString(fmt.Sprintf("%s%-5s\x1b[m", levelColor, record.level))
+	if record.message != "" {
+		builder.WriteString(" " + messageColor + clean(record.message) + "\x1b[m")
+	}
+	for _, field := range record.fields {
+		builder.WriteString(" \x1b[2m" + clean(field) + "\x1b[m")
+	}
+
+	return builder.String()
+}
+
+// Parse a line on its own, without looking at the lines before it
+func newLogLine(source *Line) *_LogLine {
+	logLine := &_LogLine{source: source, formatted: source}
+	record := parseLogLine(source.Plain(nil))
+	if record != nil {
+		logLine.level = record.level
+		logLine.hasLevel = true
+		formatted := NewLine(record.format())
+		logLine.formatted = &formatted
+	}
+
+	return logLine
+}
+
+// Give a line without a level of its own the level of the line before it
+func (logLine *_LogLine) inheritLevel(level _LogLevel) {
+	logLine.level = level
+
+	_, messageColor := level.colors()
+	if messageColor != "" && !strings.ContainsAny(logLine.source.raw, "\x1b\b") {
+		colored := NewLine(messageColor + logLine.source.raw + "\x1b[m")
+		logLine.formatted = &colored
+	}
+}
+
+// Parse a line if we haven't already, and return the parsed version
+func (view *_LogView) line(inputLines []*Line, lineIndex int) *_LogLine {
+	if len(view.lines) < len(inputLines) {
+		view.lines = append(view.lines, make([]*_LogLine, len(inputLines)-len(view.lines))...)
+	}
+
+	// Parse backwards until we find a line with a level of its own, or one
+	// we have already parsed
+	first := lineIndex
+	for ; first >= 0; first-- {
+		logLine := view.lines[first]
+		if logLine != nil && logLine.source == inputLines[first] {
+			break
+		}
+
+		logLine = newLogLine(inputLines[first])
+		view.lines[first] = logLine
+		if logLine.hasLevel {
+			break
+		}
+	}
+
+	// Continuation lines, like stack traces, go with the line before them
+	if first < 0 {
+		first = 0
+	}
+	for i := first + 1; i <= lineIndex; i++ {
+		if !view.lines[i].hasLevel {
+			view.lines[i].inheritLevel(view.lines[i-1].level)
+		}
+	}
+
+	return view.lines[lineIndex]
+}
+
+func (view *_LogView) level(inputLines []*Line, lineIndex int) _LogLevel {
+	return view.line(inputLines, lineIndex).level
+}
+
+// Hide log lines below some level. If we don't know yet whether we're showing
+// log lines, the level is used once we do.
+func (reader *Reader) setMinLogLevel(level _LogLevel) {
+	reader.Lock()
+	defer reader.Unlock()
+
+	if reader.logView == nil {
+		reader.pendingMinLogLevel = level
+		return
+	}
+
+	reader.logView.minLevel = level
+	reader.updateFilterUnlocked()
+}
+
+// Wait for the first input line, and start showing the input as log lines if
+// it is a logfmt or JSON log line with a level.
+func (reader *Reader) detectLog() {
+	if reader.options.forceJson {
+		return
+	}
+
+	firstLine, found := reader.waitForFirstLine()
+	if !found {
+		return
+	}
+
+	if parseLogLine(firstLine) != nil {
+		reader.Lock()
+		if !reader.replaced {
+			log.Debug("Showing input as log lines")
+			reader.logView = &_LogView{minLevel: reader.pendingMinLogLevel}
+			if reader.pendingMinLogLevel != _LogLevelNone {
+				reader.updateFilterUnlocked()
+			}
+		}
+		reader.Unlock()
+		reader.signalMoreLinesAdded()
+	}
+}
+
+func (r *Reader) isShowingLog() bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.logView != nil
+}
+
+// The line number of the next line with an error after a line, or of the
+// previous one before it if backwards is true. Returns 0 if there is none.
+func (r *Reader) findLogError(lineNumberOneBased int, backwards bool) int {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.logView == nil {
+		return 0
+	}
+
+	step := 1
+	if backwards {
+		step = -1
+	}
+
+	lineCount := r.lineCountUnlocked()
+	for lineNumber := lineNumberOneBased + step; lineNumber >= 1 && lineNumber <= lineCount; lineNumber += step {
+		lineIndex := lineNumber - 1
+		if r.filter != nil {
+			filtered := r.filter.lines[lineIndex]
+			if !filtered.accepted {
+				// Context or separator
+				continue
+			}
+			lineIndex = filtered.index
+		}
+
+		logLine := r.logView.line(r.lines, lineIndex)
+		if logLine.hasLevel && logLine.level >= _LogLevelError {
+			return lineNumber
+		}
+	}
+
+	return 0
+}
+
+// Hide one more level of log lines for positive deltas, or show one more for
+// negative ones
+func (p *Pager) changeMinLogLevel(delta int) {
+	if !p.reader.isShowingLog() {
+		p.message = "Log levels are only available for logfmt and JSON logs"
+		return
+	}
+
+	p.refilter(func() {
+		p.reader.Lock()
+		defer p.reader.Unlock()
+
+		level := p.reader.logView.minLevel + _LogLevel(delta)
+		if level == _LogLevelTrace {
+			// Hiding only lines without any level is pointless, skip that
+			if delta > 0 {
+				level = _LogLevelDebug
+			} else {
+				level = _LogLevelNone
+			}
+		}
+		if level < _LogLevelNone {
+			level = _LogLevelNone
+		}
+		if level > _LogLevelFatal {
+			level = _LogLevelFatal
+		}
+
+		p.reader.logView.minLevel = level
+		p.reader.updateFilterUnlocked()
+	})
+}
+
+// Scroll to the next log line with an error below the screen, or to the
+// previous one above it
+func (p *Pager) scrollToLogError(backwards bool) {
+	if !p.reader.isShowingLog() {
+		p.message = "Finding errors only works for logfmt and JSON logs"
+		return
+	}
+
+	startLineNumber := p.lineNumberOneBased()
+	if !backwards {
+		lastVisible := p.getLastVisiblePosition()
+		if lastVisible == nil {
+			return
+		}
+		startLineNumber = lastVisible.lineNumberOneBased(p)
+	}
+
+	lineNumber := p.reader.findLogError(startLineNumber, backwards)
+	if lineNumber == 0 {
+		p.message = "No more errors"
+		return
+	}
+
+	p.scrollPosition = NewScrollPositionFromLineNumberOneBased(lineNumber, "scrollToLogError")
+	p.TargetLineNumberOneBased = 0
+}
@@ -0,0 +1,134 @@
+package m
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+const _TestLog = `time=10:00 level=info msg="starting up" port=8080
+time=10:01 level=debug msg=details
+time=10:02 level=error msg="it broke"
+    at main.go:12
+time=10:03 level=warn msg="running low"
+time=10:04 level=error msg="broke again"`
+
+// Read some text as a stream, and wait for it to be shown as log lines
+func logReader(t *testing.T, text string) *Reader {
+	reader := NewHighlightingReaderFromStream("", strings.NewReader(text), *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, reader._wait())
+
+	waitFor(t, "Input never shown as log lines", reader.isShowingLog)
+
+	return reader
+}
+
+func TestParseLogfmt(t *testing.T) {
+	assert.DeepEqual(t, parseLogfmt(`a=1 b="two \"2\"" c=`), [][2]string{
+		{"a", "1"},
+		{"b", `two "2"`},
+		{"c", ""},
+	})
+
+	assert.Assert(t, parseLogfmt("just text") == nil)
+	assert.Assert(t, parseLogfmt(`a="unterminated`) == nil)
+}
+
+func TestParseLogLine(t *testing.T) {
+	record := parseLogLine(`ts=10:00 lvl=WARNING msg="disk full" disk="/dev/sda 1"`)
+	assert.Equal(t, record.time, "10:00")
+	assert.Equal(t, record.level, _LogLevelWarn)
+	assert.Equal(t, record.message, "disk full")
+	assert.DeepEqual(t, record.fields, []string{`disk="/dev/sda 1"`})
+
+	record = parseLogLine(`{"time": "10:00", "level": 50, "msg": "oops", "n": [1]}`)
+	assert.Equal(t, record.level, _LogLevelError)
+	assert.DeepEqual(t, record.fields, []string{"n=[1]"})
+
+	plain := NewLine(record.format())
+	assert.Equal(t, plain.Plain(nil), "10:00 ERROR oops n=[1]")
+
+	assert.Assert(t, parseLogLine(`a=1 b=2`) == nil)
+	assert.Assert(t, parseLogLine(`{"level": "chatty"}`) == nil)
+}
+
+func TestLogLines(t *testing.T) {
+	reader := logReader(t, _TestLog)
+
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		"10:00 INFO  starting up port=8080",
+		"10:01 DEBUG details",
+		"10:02 ERROR it broke",
+		"    at main.go:12",
+		"10:03 WARN  running low",
+		"10:04 ERROR broke again",
+	})
+
+	// Stack traces get the color of the line before them
+	assert.Assert(t, strings.HasPrefix(reader.GetLine(4).raw, "\x1b[31m"), reader.GetLine(4).raw)
+
+	lines, _ := reader.GetLines(1, 1)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "[log]: "), lines.statusText)
+}
+
+func TestJsonLogsAreNotJson(t *testing.T) {
+	reader := logReader(t, `{"level": "info", "msg": "hello"}`)
+	assert.Assert(t, !reader.isShowingJson())
+	assert.DeepEqual(t, readLines(t, reader), []string{"INFO  hello"})
+}
+
+func TestLogLevelFilter(t *testing.T) {
+	reader := logReader(t, _TestLog)
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.redraw("")
+
+	// Hide trace, debug, info and then warn
+	pager.onRune('v')
+	pager.onRune('v')
+	pager.onRune('v')
+	pager.onRune('v')
+	assert.DeepEqual(t, readLines(t, reader), []string{
+		"10:02 ERROR it broke",
+		"    at main.go:12",
+		"10:04 ERROR broke again",
+	})
+
+	// Line numbers are the ones from the input
+	assert.Equal(t, reader.displayLineNumber(3), 6)
+
+	lines, _ := reader.GetLines(1, 3)
+	assert.Assert(t, strings.HasSuffix(lines.statusText, "  level ≥ ERROR"), lines.statusText)
+
+	// Showing everything again
+	pager.onRune('V')
+	pager.onRune('V')
+	pager.onRune('V')
+	pager.onRune('V')
+	assert.Equal(t, reader.GetLineCount(), 6)
+	assert.Equal(t, reader.displayLineNumber(6), 6)
+}
+
+func TestLogErrorJumps(t *testing.T) {
+	reader := logReader(t, _TestLog+strings.Repeat("\ntime=10:05 level=info msg=fine", 10))
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 3)
+	pager.redraw("")
+
+	pager.onRune(']')
+	assert.Equal(t, pager.lineNumberOneBased(), 3)
+
+	// Not on the stack trace, but on the next error
+	pager.onRune(']')
+	assert.Equal(t, pager.lineNumberOneBased(), 6)
+
+	pager.onRune(']')
+	assert.Equal(t, pager.message, "No more errors")
+
+	pager.onRune('[')
+	assert.Equal(t, pager.lineNumberOneBased(), 3)
+}
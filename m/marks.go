@@ -0,0 +1,252 @@
+package m
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// A position the user marked using m<letter>, or one to go back to using
+// CTRL-o
+type _Mark struct {
+	reader   *Reader
+	position _InputPosition
+}
+
+// A place in the input of a Reader. Unlike line numbers, these stay put when
+// lines are filtered, JSON is folded or binary input is shown as hex.
+type _InputPosition struct {
+	// Zero-based index among the input lines, or among the hex dump lines if
+	// hex is set
+	lineIndex int
+	hex       bool
+
+	// Set for lines of JSON views
+	jsonRecord *_JsonRecord
+	jsonNode   *_JsonNode
+}
+
+// Where in the input some line is
+func (r *Reader) inputPosition(lineNumberOneBased int) _InputPosition {
+	r.Lock()
+	defer r.Unlock()
+
+	lineIndex := r.unfilteredLineNumberUnlocked(lineNumberOneBased) - 1
+	if lineIndex < 0 {
+		// A filter separator, use the line after it
+		lineIndex = r.unfilteredLineNumberUnlocked(lineNumberOneBased+1) - 1
+	}
+	if lineIndex < 0 {
+		lineIndex = 0
+	}
+
+	position := _InputPosition{lineIndex: lineIndex, hex: r.showingHex}
+	if r.json != nil && lineIndex < r.unfilteredLineCountUnlocked() {
+		record := r.json.lineRecords[lineIndex]
+		position.jsonRecord = record
+
+		offset := r.json.lineOffsets[lineIndex]
+		if offset < len(record.nodes) {
+			position.jsonNode = record.nodes[offset]
+		}
+	}
+
+	return position
+}
+
+// The one-based number of the input line shown on some line, or 0 if that line
+// doesn't show any single input line
+func (r *Reader) inputLineNumber(lineNumberOneBased int) int {
+	r.Lock()
+	defer r.Unlock()
+	return r.inputLineNumberUnlocked(lineNumberOneBased)
+}
+
+func (r *Reader) inputLineNumberUnlocked(lineNumberOneBased int) int {
+	if lineNumberOneBased < 1 || lineNumberOneBased > r.lineCountUnlocked() {
+		return 0
+	}
+
+	lineIndex := r.unfilteredLineNumberUnlocked(lineNumberOneBased) - 1
+	if lineIndex < 0 || r.showingHex {
+		return 0
+	}
+
+	if r.json != nil {
+		if r.json.isDocument || lineIndex >= len(r.json.lineRecords) {
+			return 0
+		}
+		return r.json.lineRecords[lineIndex].inputLineIndex + 1
+	}
+
+	return lineIndex + 1
+}
+
+// The line number some input position has before filtering
+func (r *Reader) unfilteredLineNumberOf(position _InputPosition) int {
+	r.Lock()
+	defer r.Unlock()
+
+	lineCount := r.unfilteredLineCountUnlocked() // Updates any JSON view
+	if r.json != nil {
+		if position.jsonRecord != nil {
+			return r.json.nodeLineIndex(position.jsonRecord, position.jsonNode) + 1
+		}
+
+		if !r.json.isDocument && position.lineIndex < len(r.json.records) {
+			// From before we started showing JSON lines, which have one
+			// record per input line
+			return r.json.nodeLineIndex(r.json.records[position.lineIndex], nil) + 1
+		}
+	}
+
+	lineIndex := position.lineIndex
+	if r.hexDump != nil && position.hex != r.showingHex {
+		// Go to the same relative position in the other view, like
+		// toggleHex() does
+		fromCount, toCount := r.inputLineCountUnlocked(), r.hexDump.count()
+		if position.hex {
+			fromCount, toCount = toCount, fromCount
+		}
+		if fromCount > 0 {
+			lineIndex = lineIndex * toCount / fromCount
+		}
+	}
+
+	if lineIndex >= lineCount {
+		lineIndex = lineCount - 1
+	}
+	return lineIndex + 1
+}
+
+// A mark at the current line
+func (p *Pager) currentMark() _Mark {
+	// Before paging starts there's no screen to canonicalize our position for
+	lineNumber := p.scrollPosition.internalDontTouch.lineNumberOneBased
+	if p.screen != nil {
+		lineNumber = p.lineNumberOneBased()
+	}
+
+	return _Mark{
+		reader:   p.reader,
+		position: p.reader.inputPosition(lineNumber),
+	}
+}
+
+// The line number of a mark in the current Reader. If a filter hides the
+// marked line, this is the first line after it.
+func (p *Pager) markLineNumber(mark _Mark) int {
+	lineNumber, _ := p.reader.filteredLineNumber(p.reader.unfilteredLineNumberOf(mark.position))
+	return lineNumber
+}
+
+// Move marks and jumps over to a Reader replacing another one, for when
+// reloading
+func (p *Pager) moveMarks(from *Reader, to *Reader) {
+	for name, mark := range p.marks {
+		if mark.reader == from {
+			p.marks[name] = mark.movedTo(to)
+		}
+	}
+
+	for i, jump := range p.jumps {
+		if jump.reader == from {
+			p.jumps[i] = jump.movedTo(to)
+		}
+	}
+}
+
+func (mark _Mark) movedTo(reader *Reader) _Mark {
+	position := mark.position
+	if position.jsonRecord != nil {
+		// The new Reader has JSON records of its own, go by input line
+		position = _InputPosition{lineIndex: position.jsonRecord.inputLineIndex}
+	}
+
+	return _Mark{reader: reader, position: position}
+}
+
+func isMarkName(char rune) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func (p *Pager) addSetMarkFooter() {
+	p.addPromptFooter("Set mark, press a letter: ")
+}
+
+func (p *Pager) onSetMarkKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	default:
+		log.Tracef("Unhandled set mark key event %v, treating as a viewing key event", key)
+		p.mode = _Viewing
+		p.onKey(key)
+	}
+}
+
+func (p *Pager) onSetMarkRune(char rune) {
+	p.mode = _Viewing
+
+	if !isMarkName(char) {
+		log.Debugf("Not a mark name: '%s'/0x%08x", string(char), int32(char))
+		return
+	}
+
+	if p.marks == nil {
+		p.marks = map[rune]_Mark{}
+	}
+	p.marks[char] = p.currentMark()
+	p.message = "Mark '" + string(char) + "' set"
+}
+
+func (p *Pager) addJumpToMarkFooter() {
+	p.addPromptFooter("Jump to mark, press a letter or ' to go back: ")
+}
+
+func (p *Pager) onJumpToMarkKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	default:
+		log.Tracef("Unhandled jump to mark key event %v, treating as a viewing key event", key)
+		p.mode = _Viewing
+		p.onKey(key)
+	}
+}
+
+func (p *Pager) onJumpToMarkRune(char rune) {
+	p.mode = _Viewing
+
+	if char == '\'' {
+		// '' goes back to where we were before the last jump, like in less
+		p.stepJumps(-1)
+		return
+	}
+
+	if !isMarkName(char) {
+		log.Debugf("Not a mark name: '%s'/0x%08x", string(char), int32(char))
+		return
+	}
+
+	mark, found := p.marks[char]
+	if !found || (mark.reader != p.reader && mark.reader != p.tailPreviewSource) {
+		p.message = "No mark '" + string(char) + "' in this file"
+		return
+	}
+
+	p.pushJump()
+	p.goToMark(mark)
+}
+
+// Returns the line number of a mark in the current Reader, or 0 if there is no
+// such mark here
+func (p *Pager) markLineNumberOneBased(name rune) int {
+	mark, found := p.marks[name]
+	if !found || mark.reader != p.reader {
+		return 0
+	}
+
+	return p.markLineNumber(mark)
+}
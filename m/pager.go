@@ -5,6 +5,7 @@ import (
 	"math"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alecthomas/chroma/v2"
@@ -19,6 +20,13 @@ const (
 	_Searching
 	_NotFound
 	_GotoLine
+	_ColonCommand
+	_SettingMark
+	_JumpingToMark
+	_PickingPipeRange
+	_TypingPipeCommand
+	_Saving
+	_Filtering
 )
 
 type StatusBarStyle int
@@ -38,6 +46,7 @@ const (
 )
 
 type eventSpinnerUpdate struct {
+	reader  *Reader
 	spinner string
 }
 
@@ -63,12 +72,77 @@ type Pager struct {
 	searchPattern  *regexp.Regexp
 	gotoLineString string
 
+	// Shown in the status bar instead of the help text until the next
+	// keypress
+	message string
+
+	// Set using m<letter>, jumped to using '<letter> or used for picking
+	// what lines to pipe
+	marks map[rune]_Mark
+
+	// Where we were before jumping somewhere else, see pushJump(). When
+	// stepping back and forth using CTRL-o / CTRL-i, jumpIndex is where in
+	// the list we are, otherwise it's len(jumps).
+	jumps     []_Mark
+	jumpIndex int
+
+	// Set up while the user is typing a command to pipe lines to
+	pipeRange         _PipeRange
+	pipeCommandString string
+	pipeShowOutput    bool
+
+	// Set up while the user is typing a filename to save to
+	saveFilename string
+	saveRaw      bool
+
+	// Set up while the user is typing a filter, see Reader.setFilter(). The
+	// number of context lines is kept for the next filter.
+	filterString  string
+	filterContext int
+
+	// Where to scroll once our filter has checked enough lines, see
+	// scrollToUnfilteredLine()
+	pendingUnfilteredLineNumber int
+
 	// We used to have a "Following" field here. If you want to follow, set
 	// TargetLineNumberOneBased to math.MaxInt instead, see below.
 
 	isShowingHelp bool
 	preHelpState  *_PreHelpState
 
+	// Views we came from when opening something from a directory listing,
+	// the last one is the one to return to on quit
+	parentViews []_ParentView
+
+	// One-based line number of the selected line in directory listings and
+	// JSON views
+	cursor int
+
+	// All files we're paging, p.reader is one of these unless we're showing
+	// help. Switch between them using :n and :p.
+	readers          []*Reader
+	fileStates       []*_FileState
+	currentFileIndex int
+
+	// If we're showing the end of a file before we're done reading all of
+	// it, this is the Reader that's still reading, and p.reader is a preview
+	// of the end of the file.
+	tailPreviewSource *Reader
+
+	// Set after reloading until we know which lines changed
+	pendingReload *_PendingReload
+
+	// Lines that changed in the last reload, marked for a little while
+	changedLines *_ChangedLines
+
+	// Readers we have already started listening for updates from
+	watchedReaders map[*Reader]bool
+
+	// Readers we created ourselves, for nested views, reloads and such.
+	// Readers we were given could be paged again, so we don't release those
+	// unless ReleaseReaders is set.
+	ownedReaders map[*Reader]bool
+
 	// NewPager shows lines by default, this field can hide them
 	ShowLineNumbers bool
 
@@ -96,6 +170,35 @@ type Pager struct {
 	// clear the last line, and show the cursor.
 	DeInit bool
 
+	// If true, the Readers we were given are released when paging is done,
+	// closing their files and running any LESSCLOSE command. Don't set this
+	// if you want to page the same Readers again.
+	ReleaseReaders bool
+
+	// Called for keypresses while viewing, before moar handles them. Return
+	// true if the key was handled, and moar should ignore it.
+	KeyHandler  func(p *Pager, key twin.KeyCode) bool
+	RuneHandler func(p *Pager, char rune) bool
+
+	// If set, the status bar shows whatever this returns rather than the
+	// default text
+	StatusBarText func(p *Pager, defaultText string) string
+
+	// Called with the first visible line number when the pager starts up, and
+	// then whenever the pager has scrolled to another line
+	OnScroll func(p *Pager, firstVisibleLineOneBased int)
+
+	// Called when the pager is done, before StartPaging() returns
+	OnQuit func(p *Pager)
+
+	// Calls made using post(), waiting to be run by the main loop
+	pendingCalls     []func(p *Pager)
+	pendingCallsLock sync.Mutex
+	callsPosted      chan bool
+
+	// The line number we last told OnScroll about
+	reportedLineNumberOneBased int
+
 	// Optional ANSI to prefix each text line with. Initialised using
 	// ChromaStyle and ChromaFormatter.
 	linePrefix string
@@ -118,20 +221,39 @@ Miscellaneous
 * Press 'q' or 'ESC' to quit
 * Press 'w' to toggle wrapping of long lines
 * Press '=' to toggle showing the status bar at the bottom
+* Press 'R' to reload the file from disk, changed lines will be marked
+* Press 'x' to toggle between hex and text views of binary files
+* Press 'E' to show the details of any errors reading the input
+* Press 'P' to pause / resume re-running the command when using --watch
+* Press 's' to save what has been read so far to a file
+* Press 'v' / 'V' to hide / show more log levels in logfmt and JSON logs
+* Press '|' to pipe the screen, everything or the lines from a mark to a
+  shell command
 
 Moving around
 -------------
 * Arrow keys
 * Alt key plus left / right arrow steps one column at a time
 * Left / right can be used to hide / show line numbers
+* Left / right step one column at a time in CSV / TSV tables
 * CTRL-p moves to the previous line
 * CTRL-n moves to the next line
 * 'g' for going to a specific line number
+* RETURN opens the entry under the cursor in directory listings, 'q' goes back
+* RETURN folds / unfolds the JSON under the cursor, '+' / '-' unfolds / folds
+  all JSON
+* 'm' followed by a letter sets a mark at the current line
+* ' followed by a letter goes to that mark, '' goes back to where you were
+* CTRL-o / CTRL-i go back / forward to where you were before searching, going
+  to a line number, to the start / end or to a mark
+* '[' / ']' for the previous / next error in logfmt and JSON logs
+* ':n' / ':p' for the next / previous file when paging multiple files
 * PageUp / 'b' and PageDown / 'f'
 * SPACE moves down a page
 * Home and End for start / end of the document
 * < / 'gg' to go to the start of the document
-* > / 'G' to go to the end of the document
+* > / 'G' to go to the end of the document, large files show their end
+  before they are fully read, with estimated line numbers
 * 'h', 'l' for left and right (as in vim)
 * Half page 'u'p / 'd'own, or CTRL-u / CTRL-d
 * RETURN moves down one line
@@ -144,6 +266,11 @@ Searching
 * Find previous by typing SHIFT-N or 'p' (for "previous")
 * Search is case sensitive if it contains any UPPER CASE CHARACTERS
 * Search is interpreted as a regexp if it is a valid one
+* Type & followed by a pattern to show only lines matching it, start the
+  pattern with ! to show only lines not matching it. An empty pattern shows
+  all lines again.
+* While typing the filter pattern, press UP / DOWN to show more / fewer
+  context lines around each match, like "grep -C"
 
 Reporting bugs
 --------------
@@ -172,8 +299,14 @@ func NewPager(r *Reader) *Pager {
 	} else {
 		name = "Pager " + *r.name
 	}
+	readers := []*Reader{}
+	if r != nil {
+		readers = append(readers, r)
+	}
 	return &Pager{
 		reader:           r,
+		readers:          readers,
+		fileStates:       make([]*_FileState, len(readers)),
 		quit:             false,
 		ShowLineNumbers:  true,
 		ShowStatusBar:    true,
@@ -182,6 +315,7 @@ func NewPager(r *Reader) *Pager {
 		ScrollLeftHint:   twin.NewCell('<', twin.StyleDefault.WithAttr(twin.AttrReverse)),
 		ScrollRightHint:  twin.NewCell('>', twin.StyleDefault.WithAttr(twin.AttrReverse)),
 		scrollPosition:   newScrollPosition(name),
+		callsPosted:      make(chan bool, 1),
 	}
 }
 
@@ -190,7 +324,11 @@ func NewPager(r *Reader) *Pager {
 func (p *Pager) visibleHeight() int {
 	_, height := p.screen.Size()
 	if p.ShowStatusBar {
-		return height - 1
+		height--
+	}
+	if p.hasFrozenHeader() {
+		// The header takes up the top line
+		height--
 	}
 	return height
 }
@@ -221,20 +359,69 @@ func (p *Pager) setFooter(footer string) {
 	}
 }
 
+// Show a prompt followed by a cursor in the footer
+func (p *Pager) addPromptFooter(prompt string) {
+	width, height := p.screen.Size()
+
+	pos := 0
+	for _, token := range prompt {
+		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault))
+		pos++
+	}
+
+	// Add a cursor
+	p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
+	pos++
+
+	// Clear the rest of the line
+	for pos < width {
+		p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault))
+		pos++
+	}
+}
+
+// Show some Reader instead of the current one, until the user presses 'q'.
+// Used for the help screen and for showing errors.
+func (p *Pager) showOverlay(reader *Reader) {
+	if p.isShowingHelp {
+		return
+	}
+
+	p.preHelpState = &_PreHelpState{
+		reader:                   p.reader,
+		scrollPosition:           p.scrollPosition,
+		leftColumnZeroBased:      p.leftColumnZeroBased,
+		targetLineNumberOneBased: p.TargetLineNumberOneBased,
+	}
+	p.reader = reader
+	p.scrollPosition = newScrollPosition("Pager scroll position")
+	p.leftColumnZeroBased = 0
+	p.TargetLineNumberOneBased = 0
+	p.isShowingHelp = true
+}
+
 // Quit leaves the help screen or quits the pager
 func (p *Pager) Quit() {
 	if !p.isShowingHelp {
+		if p.closeNestedView() {
+			return
+		}
+
 		p.quit = true
 		return
 	}
 
 	// Reset help
 	p.isShowingHelp = false
+	p.releaseIfOwned(p.reader)
 	p.reader = p.preHelpState.reader
 	p.scrollPosition = p.preHelpState.scrollPosition
 	p.leftColumnZeroBased = p.preHelpState.leftColumnZeroBased
 	p.TargetLineNumberOneBased = p.preHelpState.targetLineNumberOneBased
 	p.preHelpState = nil
+
+	// The real Reader could have finished while we were showing help
+	p.maybeEndTailPreview()
 }
 
 // Negative deltas move left instead
@@ -250,6 +437,10 @@ func (p *Pager) moveRight(delta int) {
 	}
 
 	result := p.leftColumnZeroBased + delta
+	if table := p.table(); table != nil {
+		// Step one column at a time
+		result = table.sideScrollTarget(p.leftColumnZeroBased, delta)
+	}
 	if result < 0 {
 		p.leftColumnZeroBased = 0
 	} else {
@@ -259,9 +450,11 @@ func (p *Pager) moveRight(delta int) {
 
 func (p *Pager) handleScrolledUp() {
 	p.TargetLineNumberOneBased = 0
+	p.pendingUnfilteredLineNumber = 0
 }
 
 func (p *Pager) handleScrolledDown() {
+	p.pendingUnfilteredLineNumber = 0
 	if p.isScrolledToEnd() {
 		p.TargetLineNumberOneBased = math.MaxInt
 	} else {
@@ -278,13 +471,52 @@ func (p *Pager) onKey(keyCode twin.KeyCode) {
 		p.onGotoLineKey(keyCode)
 		return
 	}
+	if p.mode == _ColonCommand {
+		p.onColonCommandKey(keyCode)
+		return
+	}
+	if p.mode == _SettingMark {
+		p.onSetMarkKey(keyCode)
+		return
+	}
+	if p.mode == _JumpingToMark {
+		p.onJumpToMarkKey(keyCode)
+		return
+	}
+	if p.mode == _PickingPipeRange {
+		p.onPipeRangeKey(keyCode)
+		return
+	}
+	if p.mode == _TypingPipeCommand {
+		p.onPipeCommandKey(keyCode)
+		return
+	}
+	if p.mode == _Saving {
+		p.onSaveKey(keyCode)
+		return
+	}
+	if p.mode == _Filtering {
+		p.onFilterKey(keyCode)
+		return
+	}
 	if p.mode != _Viewing && p.mode != _NotFound {
 		panic(fmt.Sprint("Unhandled mode: ", p.mode))
 	}
 
+	// Messages are only shown until the next keypress
+	p.message = ""
+
 	// Reset the not-found marker on non-search keypresses
 	p.mode = _Viewing
 
+	if p.KeyHandler != nil && p.KeyHandler(p, keyCode) {
+		return
+	}
+
+	if p.onCursorKey(keyCode) {
+		return
+	}
+
 	switch keyCode {
 	case twin.KeyEscape:
 		p.Quit()
@@ -312,10 +544,14 @@ func (p *Pager) onKey(keyCode twin.KeyCode) {
 		p.moveRight(-1)
 
 	case twin.KeyHome:
+		p.endTailPreview()
+		p.pushJump()
 		p.scrollPosition = newScrollPosition("Pager scroll position")
 		p.handleScrolledUp()
 
 	case twin.KeyEnd:
+		p.pushJump()
+		p.startTailPreview()
 		p.scrollToEnd()
 
 	case twin.KeyPgUp:
@@ -340,28 +576,70 @@ func (p *Pager) onRune(char rune) {
 		p.onGotoLineRune(char)
 		return
 	}
+	if p.mode == _ColonCommand {
+		p.onColonCommandRune(char)
+		return
+	}
+	if p.mode == _SettingMark {
+		p.onSetMarkRune(char)
+		return
+	}
+	if p.mode == _JumpingToMark {
+		p.onJumpToMarkRune(char)
+		return
+	}
+	if p.mode == _PickingPipeRange {
+		p.onPipeRangeRune(char)
+		return
+	}
+	if p.mode == _TypingPipeCommand {
+		p.onPipeCommandRune(char)
+		return
+	}
+	if p.mode == _Saving {
+		p.onSaveRune(char)
+		return
+	}
+	if p.mode == _Filtering {
+		p.onFilterRune(char)
+		return
+	}
 	if p.mode != _Viewing && p.mode != _NotFound {
 		panic(fmt.Sprint("Unhandled mode: ", p.mode))
 	}
 
+	// Messages are only shown until the next keypress
+	p.message = ""
+
+	if p.RuneHandler != nil && p.RuneHandler(p, char) {
+		return
+	}
+
+	if p.onCursorRune(char) {
+		return
+	}
+
 	switch char {
 	case 'q':
 		p.Quit()
 
 	case '?':
-		if !p.isShowingHelp {
-			p.preHelpState = &_PreHelpState{
-				reader:                   p.reader,
-				scrollPosition:           p.scrollPosition,
-				leftColumnZeroBased:      p.leftColumnZeroBased,
-				targetLineNumberOneBased: p.TargetLineNumberOneBased,
-			}
-			p.reader = _HelpReader
-			p.scrollPosition = newScrollPosition("Pager scroll position")
-			p.leftColumnZeroBased = 0
-			p.TargetLineNumberOneBased = 0
-			p.isShowingHelp = true
-		}
+		p.showOverlay(_HelpReader)
+
+	case 'E':
+		p.showErrors()
+
+	case 'v':
+		p.changeMinLogLevel(1)
+
+	case 'V':
+		p.changeMinLogLevel(-1)
+
+	case ']':
+		p.scrollToLogError(false)
+
+	case '[':
+		p.scrollToLogError(true)
 
 	case '=':
 		p.ShowStatusBar = !p.ShowStatusBar
@@ -389,10 +667,14 @@ func (p *Pager) onRune(char rune) {
 		p.moveRight(-p.SideScrollAmount)
 
 	case '<':
+		p.endTailPreview()
+		p.pushJump()
 		p.scrollPosition = newScrollPosition("Pager scroll position")
 		p.handleScrolledUp()
 
 	case '>', 'G':
+		p.pushJump()
+		p.startTailPreview()
 		p.scrollToEnd()
 
 	case 'f', ' ':
@@ -416,14 +698,24 @@ func (p *Pager) onRune(char rune) {
 		p.handleScrolledDown()
 
 	case '/':
+		// Searching scrolls to the hits as we type
+		p.pushJump()
 		p.mode = _Searching
 		p.searchString = ""
 		p.searchPattern = nil
 
 	case 'g':
+		// Line numbers in tail previews are just estimates, go back to the
+		// real ones
+		p.endTailPreview()
 		p.mode = _GotoLine
 		p.gotoLineString = ""
 
+	case ':':
+		if !p.isShowingHelp {
+			p.mode = _ColonCommand
+		}
+
 	case 'n':
 		p.scrollToNextSearchHit()
 
@@ -433,6 +725,40 @@ func (p *Pager) onRune(char rune) {
 	case 'w':
 		p.WrapLongLines = !p.WrapLongLines
 
+	case 'R':
+		p.reload()
+
+	case 'x':
+		p.toggleHex()
+
+	case 'P':
+		p.toggleWatchPaused()
+
+	case 'm':
+		p.mode = _SettingMark
+
+	case '\'':
+		p.mode = _JumpingToMark
+
+	// '\x0f' = CTRL-o and '\t' = CTRL-i, like in vim
+	case '\x0f':
+		p.stepJumps(-1)
+
+	case '\t':
+		p.stepJumps(1)
+
+	case '|':
+		p.mode = _PickingPipeRange
+
+	case 's':
+		p.mode = _Saving
+		p.saveFilename = ""
+		p.saveRaw = false
+
+	case '&':
+		p.mode = _Filtering
+		p.filterString = ""
+
 	default:
 		log.Debugf("Unhandled rune keypress '%s'/0x%08x", string(char), int32(char))
 	}
@@ -465,25 +791,21 @@ func getLineColorPrefix(chromaStyle *chroma.Style, chromaFormatter *chroma.Forma
 	return formatted[:cutoff]
 }
 
-// StartPaging brings up the pager on screen
-func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chromaFormatter *chroma.Formatter) {
-	log.Trace("Pager starting")
-	defer log.Trace("Pager done")
-
-	defer func() {
-		if p.reader.err != nil {
-			log.Warnf("Reader reported an error: %s", p.reader.err.Error())
-		}
-	}()
-
-	unprintableStyle = p.UnprintableStyle
-	consumeLessTermcapEnvs(chromaStyle, chromaFormatter)
+// Start forwarding updates from a reader to the main loop. Calling this more
+// than once for the same reader is fine.
+func (p *Pager) watchReader(reader *Reader) {
+	if p.watchedReaders == nil {
+		p.watchedReaders = map[*Reader]bool{}
+	}
+	if p.watchedReaders[reader] {
+		return
+	}
+	p.watchedReaders[reader] = true
 
-	p.screen = screen
-	p.linePrefix = getLineColorPrefix(chromaStyle, chromaFormatter)
+	screen := p.screen
 
 	go func() {
-		for range p.reader.moreLinesAdded {
+		for range reader.moreLinesAdded {
 			// Notify the main loop about the new lines so it can show them
 			screen.Events() <- eventMoreLinesAvailable{}
 
@@ -502,11 +824,11 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 		spinnerFrames := [...]string{"/.\\", "-o-", "\\O/", "| |"}
 		spinnerIndex := 0
 		for {
-			if p.reader.done.Load() {
+			if reader.done.Load() {
 				break
 			}
 
-			screen.Events() <- eventSpinnerUpdate{spinnerFrames[spinnerIndex]}
+			screen.Events() <- eventSpinnerUpdate{reader, spinnerFrames[spinnerIndex]}
 			spinnerIndex++
 			if spinnerIndex >= len(spinnerFrames) {
 				spinnerIndex = 0
@@ -516,25 +838,121 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 		}
 
 		// Empty our spinner, loading done!
-		screen.Events() <- eventSpinnerUpdate{""}
+		screen.Events() <- eventSpinnerUpdate{reader, ""}
 	}()
 
 	go func() {
-		for range p.reader.maybeDone {
+		for range reader.maybeDone {
 			screen.Events() <- eventMaybeDone{}
 		}
 	}()
+}
+
+// Remember that we created a Reader ourselves, so that we release it when
+// we're done with it
+func (p *Pager) own(reader *Reader) {
+	if p.ownedReaders == nil {
+		p.ownedReaders = make(map[*Reader]bool)
+	}
+	p.ownedReaders[reader] = true
+}
+
+// Release a Reader we're done with, unless we were given it
+func (p *Pager) releaseIfOwned(reader *Reader) {
+	if !p.ownedReaders[reader] {
+		return
+	}
+
+	delete(p.ownedReaders, reader)
+	reader.release()
+}
+
+// Release the Readers we created, for when paging is done
+func (p *Pager) releaseReaders() {
+	for reader := range p.ownedReaders {
+		reader.release()
+	}
+	p.ownedReaders = nil
+
+	if !p.ReleaseReaders {
+		return
+	}
+	for _, reader := range p.readers {
+		reader.release()
+	}
+}
+
+// StartPaging brings up the pager on screen
+func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chromaFormatter *chroma.Formatter) {
+	log.Trace("Pager starting")
+	defer log.Trace("Pager done")
+
+	defer func() {
+		for _, reader := range p.readers {
+			reader.Lock()
+			if reader.err != nil {
+				log.Warnf("Reader reported an error: %s", reader.err.Error())
+			}
+			reader.Unlock()
+		}
+
+		if p.OnQuit != nil {
+			p.OnQuit(p)
+		}
+
+		p.releaseReaders()
+	}()
+
+	unprintableStyle = p.UnprintableStyle
+	consumeLessTermcapEnvs(chromaStyle, chromaFormatter)
+
+	p.screen = screen
+	p.linePrefix = getLineColorPrefix(chromaStyle, chromaFormatter)
+
+	for _, reader := range p.readers {
+		p.watchReader(reader)
+	}
+
+	// Run calls posted before we started, and listen for more until we're
+	// done. Calls posted after that are run if we start paging again.
+	p.runPendingCalls()
+	stopListening := make(chan struct{})
+	listenerDone := make(chan struct{})
+	defer func() {
+		close(stopListening)
+		<-listenerDone
+	}()
+	go func() {
+		defer close(listenerDone)
+		for {
+			select {
+			case <-p.callsPosted:
+				select {
+				case screen.Events() <- eventCallsPosted{}:
+				case <-stopListening:
+					return
+				}
+			case <-stopListening:
+				return
+			}
+		}
+	}()
 
 	// Main loop
-	spinner := ""
+	spinners := map[*Reader]string{}
 	for !p.quit {
 		if len(screen.Events()) == 0 {
 			// Nothing more to process for now, redraw the screen
+			spinner := spinners[p.reader]
+			if p.tailPreviewSource != nil {
+				spinner = spinners[p.tailPreviewSource]
+			}
 			overflow := p.redraw(spinner)
+			p.reportScroll()
 
 			// Ref:
 			// https://github.com/gwsw/less/blob/ff8869aa0485f7188d942723c9fb50afb1892e62/command.c#L828-L831
-			if p.QuitIfOneScreen && overflow == didFit && !p.isShowingHelp {
+			if p.QuitIfOneScreen && overflow == didFit && !p.isShowingHelp && len(p.readers) <= 1 && len(p.parentViews) == 0 && p.reader.directory == nil {
 				// Do the slow (atomic) checks only if the fast ones (no locking
 				// required) passed
 				if p.reader.done.Load() && p.reader.highlightingDone.Load() {
@@ -588,6 +1006,11 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 			return
 
 		case eventMoreLinesAvailable:
+			p.maybeEndTailPreview()
+			p.maybeMarkChangedLines()
+			if p.pendingUnfilteredLineNumber > 0 {
+				p.scrollToUnfilteredLine(p.pendingUnfilteredLineNumber)
+			}
 			if p.mode.isViewing() && p.TargetLineNumberOneBased > 0 {
 				// The user wants to scroll down to a specific line number
 				if p.reader.GetLineCount() >= p.TargetLineNumberOneBased {
@@ -600,11 +1023,26 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 			}
 
 		case eventMaybeDone:
-			// Do nothing. We got this just so that we'll do the QuitIfOneScreen
-			// check (above) as soon as highlighting is done.
+			// If we were previewing the end of the file, we can show the real
+			// thing now
+			p.maybeEndTailPreview()
+
+			// Or mark what changed if we just reloaded
+			p.maybeMarkChangedLines()
+
+			// Apart from that, we got this just so that we'll do the
+			// QuitIfOneScreen check (above) as soon as highlighting is done.
 
 		case eventSpinnerUpdate:
-			spinner = event.spinner
+			spinners[event.reader] = event.spinner
+
+		case eventCallsPosted:
+			p.runPendingCalls()
+
+		case eventClearChangedLines:
+			if p.changedLines != nil && p.changedLines.reader == event.reader {
+				p.changedLines = nil
+			}
 
 		default:
 			log.Warnf("Unhandled event type: %v", event)
@@ -73,9 +73,31 @@ func TestPageEmpty(t *testing.T) {
 }
 
 func TestBrokenUtf8(t *testing.T) {
-	// The broken UTF8 character in the middle is based on "©" = 0xc2a9
+	// The broken UTF8 character in the middle is based on "©" = 0xc2a9. With
+	// no valid UTF-8 anywhere, this is taken to be in a legacy encoding.
 	reader := NewReaderFromStream("", strings.NewReader("abc\xc2def"))
 
+	var answers = []twin.Cell{
+		twin.NewCell('a', twin.StyleDefault),
+		twin.NewCell('b', twin.StyleDefault),
+		twin.NewCell('c', twin.StyleDefault),
+		twin.NewCell('Â', twin.StyleDefault),
+		twin.NewCell('d', twin.StyleDefault),
+		twin.NewCell('e', twin.StyleDefault),
+		twin.NewCell('f', twin.StyleDefault),
+	}
+
+	contents := startPaging(t, reader).GetRow(0)
+	for pos, expected := range answers {
+		assertCellsEqual(t, expected, contents[pos])
+	}
+}
+
+func TestBrokenUtf8AmongValid(t *testing.T) {
+	// The valid "©" at the end makes this look like broken UTF-8 rather than
+	// some legacy encoding
+	reader := NewReaderFromStream("", strings.NewReader("abc\xc2def ©"))
+
 	var answers = []twin.Cell{
 		twin.NewCell('a', twin.StyleDefault),
 		twin.NewCell('b', twin.StyleDefault),
@@ -608,7 +630,12 @@ func benchmarkSearch(b *testing.B, highlighted bool) {
 	// Read one copy of the example input
 	var fileContents string
 	if highlighted {
-		highlightedSourceCode, err := highlight(sourceFilename, true, *styles.Get("native"), formatters.TTY16m)
+		sourceBytes, err := os.ReadFile(sourceFilename)
+		if err != nil {
+			panic(err)
+		}
+		sourceCode := string(sourceBytes)
+		highlightedSourceCode, err := highlightText(sourceCode, pickLexer(sourceFilename, sourceCode), *styles.Get("native"), formatters.TTY16m)
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,215 @@
+package m
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// Lines to pipe to a command, one-based and inclusive
+type _PipeRange struct {
+	firstLineOneBased int
+	lastLineOneBased  int
+}
+
+func (r _PipeRange) String() string {
+	if r.firstLineOneBased == r.lastLineOneBased {
+		return fmt.Sprintf("line %d", r.firstLineOneBased)
+	}
+	return fmt.Sprintf("lines %d-%d", r.firstLineOneBased, r.lastLineOneBased)
+}
+
+func (p *Pager) addPipeRangeFooter() {
+	p.addPromptFooter("Pipe what? '.' for the screen, '%' for everything, or a mark letter: ")
+}
+
+func (p *Pager) addPipeCommandFooter() {
+	output := "shown"
+	if !p.pipeShowOutput {
+		output = "discarded"
+	}
+
+	p.addPromptFooter(fmt.Sprintf("Pipe %s to (TAB: output %s): %s", p.pipeRange, output, p.pipeCommandString))
+}
+
+func (p *Pager) onPipeRangeKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEnter:
+		// Like in less, Enter means the screen
+		p.onPipeRangeRune('.')
+
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	default:
+		log.Tracef("Unhandled pipe range key event %v, treating as a viewing key event", key)
+		p.mode = _Viewing
+		p.onKey(key)
+	}
+}
+
+func (p *Pager) onPipeRangeRune(char rune) {
+	p.mode = _Viewing
+
+	currentLine := p.lineNumberOneBased()
+	switch {
+	case char == '.':
+		lastLine := currentLine
+		lastVisible := p.getLastVisiblePosition()
+		if lastVisible != nil {
+			lastLine = lastVisible.lineNumberOneBased(p)
+		}
+		p.pipeRange = _PipeRange{currentLine, lastLine}
+
+	case char == '%':
+		p.pipeRange = _PipeRange{1, p.reader.GetLineCount()}
+
+	case isMarkName(char):
+		markLine := p.markLineNumberOneBased(char)
+		if markLine == 0 {
+			p.message = "No mark '" + string(char) + "' in this file"
+			return
+		}
+		if markLine <= currentLine {
+			p.pipeRange = _PipeRange{markLine, currentLine}
+		} else {
+			p.pipeRange = _PipeRange{currentLine, markLine}
+		}
+
+	default:
+		log.Debugf("Unhandled pipe range rune '%s'/0x%08x", string(char), int32(char))
+		return
+	}
+
+	if p.pipeRange.lastLineOneBased < p.pipeRange.firstLineOneBased {
+		p.message = "Nothing to pipe"
+		return
+	}
+
+	p.mode = _TypingPipeCommand
+	p.pipeCommandString = ""
+	p.pipeShowOutput = true
+}
+
+func (p *Pager) onPipeCommandKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEnter:
+		p.mode = _Viewing
+		if strings.TrimSpace(p.pipeCommandString) == "" {
+			return
+		}
+		p.pipe(p.pipeRange, p.pipeCommandString, p.pipeShowOutput)
+
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	case twin.KeyBackspace, twin.KeyDelete:
+		if len(p.pipeCommandString) == 0 {
+			return
+		}
+
+		p.pipeCommandString = removeLastChar(p.pipeCommandString)
+
+	default:
+		log.Tracef("Unhandled pipe command key event %v", key)
+	}
+}
+
+func (p *Pager) onPipeCommandRune(char rune) {
+	if char == '\t' {
+		p.pipeShowOutput = !p.pipeShowOutput
+		return
+	}
+
+	p.pipeCommandString += string(char)
+}
+
+// Write the plain text of some lines, one line per row
+func writePlainText(writer io.Writer, reader *Reader, lineRange _PipeRange) error {
+	bufferedWriter := bufio.NewWriter(writer)
+	for lineNumber := lineRange.firstLineOneBased; lineNumber <= lineRange.lastLineOneBased; lineNumber++ {
+		line := reader.GetLine(lineNumber)
+		if line == nil {
+			break
+		}
+		_, err := bufferedWriter.WriteString(line.Plain(&lineNumber) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return bufferedWriter.Flush()
+}
+
+// Feed some lines to a started command in the background, so that large
+// ranges don't block the UI
+func feedLines(stdin io.WriteCloser, reader *Reader, lineRange _PipeRange, commandLine string) {
+	go func() {
+		err := writePlainText(stdin, reader, lineRange)
+		if err != nil {
+			// Commands are free to stop reading early, "head" does
+			log.Debug("Writing lines to ", commandLine, " stopped: ", err)
+		}
+
+		err = stdin.Close()
+		if err != nil {
+			log.Debug("Closing stdin of ", commandLine, " failed: ", err)
+		}
+	}()
+}
+
+// Run a shell command with some lines on its stdin.
+//
+// If showOutput is true, the output of the command is shown in a buffer of its
+// own, leave it with 'q' to get back here.
+func (p *Pager) pipe(lineRange _PipeRange, commandLine string, showOutput bool) {
+	command := shellCommand(commandLine)
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		p.message = "Running " + commandLine + " failed: " + err.Error()
+		return
+	}
+
+	if !showOutput {
+		command.Stdout = io.Discard
+		command.Stderr = io.Discard
+		err := command.Start()
+		if err != nil {
+			p.message = "Running " + commandLine + " failed: " + err.Error()
+			return
+		}
+		feedLines(stdin, p.reader, lineRange, commandLine)
+
+		go func() {
+			err := command.Wait()
+			if err != nil {
+				log.Info("Piping to ", commandLine, " failed: ", err)
+			}
+		}()
+
+		p.message = fmt.Sprintf("Piped %s to %s", lineRange, commandLine)
+		return
+	}
+
+	commandOut, commandErr, err := startFilter(command)
+	if err != nil {
+		p.message = "Running " + commandLine + " failed: " + err.Error()
+		return
+	}
+	feedLines(stdin, p.reader, lineRange, commandLine)
+
+	output := newReaderFromFilter(commandLine, command, commandOut, commandErr, ReaderOptions{})
+	title := "| " + commandLine
+	output.Lock()
+	output.title = &title
+	output.Unlock()
+
+	p.own(output)
+	p.showOverlay(output)
+	if p.screen != nil {
+		p.watchReader(output)
+	}
+}
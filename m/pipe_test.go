@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package m
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func typePipeCommand(pager *Pager, command string) {
+	for _, char := range command {
+		pager.onRune(char)
+	}
+	pager.onKey(twin.KeyEnter)
+}
+
+func TestPipeEverything(t *testing.T) {
+	reader := NewReaderFromText("letters", "a\nc\nb")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.onRune('|')
+	pager.onRune('%')
+	assert.Equal(t, pager.mode, _TypingPipeCommand)
+	typePipeCommand(pager, "sort -r")
+
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.Assert(t, pager.reader != reader)
+	assert.DeepEqual(t, readLines(t, pager.reader), []string{"c", "b", "a"})
+
+	lines, _ := pager.reader.GetLines(1, 3)
+	assert.Assert(t, strings.HasPrefix(lines.statusText, "| sort -r: "), lines.statusText)
+
+	// Quitting should take us back to where we came from
+	pager.onRune('q')
+	assert.Assert(t, pager.reader == reader)
+	assert.Equal(t, pager.quit, false)
+}
+
+// Commands may stop reading before they have got all lines
+func TestPipeToHead(t *testing.T) {
+	reader := numberedReader(100_000)
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.onRune('|')
+	pager.onRune('%')
+	typePipeCommand(pager, "head -n 2")
+
+	assert.DeepEqual(t, readLines(t, pager.reader), []string{"line 1", "line 2"})
+}
+
+func TestPipeDiscardingOutput(t *testing.T) {
+	reader := NewReaderFromText("letters", "a\nb")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.onRune('|')
+	pager.onRune('%')
+	pager.onRune('\t')
+	assert.Equal(t, pager.pipeShowOutput, false)
+	typePipeCommand(pager, "cat")
+
+	assert.Assert(t, pager.reader == reader)
+	assert.Equal(t, pager.message, "Piped lines 1-2 to cat")
+}
+
+func TestPipeFromMark(t *testing.T) {
+	numbers := []string{}
+	for i := 1; i <= 50; i++ {
+		numbers = append(numbers, fmt.Sprint(i))
+	}
+	reader := NewReaderFromText("numbers", strings.Join(numbers, "\n"))
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(5, "TestPipeFromMark")
+	pager.onRune('m')
+	pager.onRune('a')
+	assert.Equal(t, pager.message, "Mark 'a' set")
+
+	// The mark comes after the current line here
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(3, "TestPipeFromMark")
+	pager.onRune('|')
+	pager.onRune('a')
+	assert.Equal(t, pager.pipeRange, _PipeRange{3, 5})
+
+	piped := strings.Builder{}
+	assert.NilError(t, writePlainText(&piped, reader, pager.pipeRange))
+	assert.Equal(t, piped.String(), "3\n4\n5\n")
+}
+
+func TestPipeFromMissingMark(t *testing.T) {
+	pager := NewPager(NewReaderFromText("numbers", "1\n2\n3"))
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.onRune('|')
+	pager.onRune('b')
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.Equal(t, pager.message, "No mark 'b' in this file")
+
+	// Messages go away on the next keypress
+	pager.onRune('j')
+	assert.Equal(t, pager.message, "")
+}
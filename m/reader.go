@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -18,7 +19,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// Reader reads a file into an array of strings.
+// Reader reads a file into an array of strings. Files larger than
+// MAX_IN_MEMORY_SIZE are instead indexed, and their lines are read from disk
+// as needed.
 //
 // It does the reading in the background, and it returns parts of the read data
 // upon request.
@@ -27,22 +30,126 @@ import (
 type Reader struct {
 	sync.Mutex
 
-	lines   []*Line
-	name    *string
+	lines []*Line
+	name  *string
+
+	// If set, shown as-is in the status bar instead of the name
+	title *string
+
+	// If set, lines are read from disk on demand rather than being kept in
+	// the lines slice above. Lines in the lines slice then come after the
+	// file backed ones, that's where lines go when following a huge file.
+	fileLines *fileBackedLines
+
+	// How to interpret the input, set before reading starts
+	options ReaderOptions
+
+	// Set if we're reading an uncompressed file without transcoding, which
+	// means we can peek at the end of it before we're done reading all of it
+	seekableFilename *string
+
+	// What we're transcoding the input from, nil means plain UTF-8
+	encoding *inputEncoding
+
+	// Set for binary input, which can be shown either as a hex dump or as
+	// text
+	hexDump    *hexDump
+	showingHex bool
+
+	// Number of bytes consumed so far, used for estimating line numbers
+	bytesRead int64
+
+	// Line numbers shown to the user are this much higher than the line's
+	// position in this Reader. Non-zero when we're showing only the end of
+	// some file.
+	lineNumberOffset int
+
+	// True if lineNumberOffset is just a guess
+	lineNumbersAreEstimates bool
+
+	// Zero-based index of the first line last requested by GetLines(). Lines
+	// around here get highlighted first.
+	highlightFocus int
+
+	// If set, creates a new Reader reading the same file as this one
+	reloader func() (*Reader, error)
+
+	// Set by FollowByName(), so that reloaded Readers can keep following
+	followingByName bool
+
+	// Set if we're showing the input as a table, see SetTableFormat()
+	table *_Table
+
+	// Set if we're showing the input as JSON, see ForceJson()
+	json *_JsonView
+
+	// Set if we're showing the input as log lines with levels
+	logView *_LogView
+
+	// The minimum level to start out with once logView is set, see
+	// setMinLogLevel()
+	pendingMinLogLevel _LogLevel
+
+	// Set if some lines are hidden, see updateFilterUnlocked()
+	filter *_LineFilter
+
+	// Set by setFilter(). If filterInverted is set, lines matching the
+	// pattern are hidden rather than shown.
+	filterString   string
+	filterPattern  *regexp.Regexp
+	filterInverted bool
+
+	// Lines around lines matching filterPattern are shown too, like
+	// "grep -C"
+	filterContext int
+
+	// Set if we're listing a directory, see NewReaderFromDirectory()
+	directory *_Directory
+
+	// Set if we're showing the output of a command, see NewReaderFromCommand()
+	command []string
+
+	// Set when our command has exited, like "exit status 1"
+	exitStatus *string
+
+	// Set by Watch(). The previous lines are from the previous command run,
+	// and are used for highlighting what changed.
+	watchInterval      time.Duration
+	watchPaused        atomic.Bool
+	watchPreviousLines []*Line
+
 	err     error
 	_stderr io.Reader
 
+	// Whatever our filter printed to stderr, shown to the user in the pager
+	stderrText string
+
 	// Have we had our contents replaced using setText()?
 	replaced bool
 
 	done             *atomic.Bool
 	highlightingDone *atomic.Bool
 
+	// Set by release(), when this Reader won't be shown any more
+	released atomic.Bool
+
+	// Set by NewWritableReader(), nobody else may change our lines using
+	// AppendLines() and friends
+	writable bool
+
+	// Run by release(), for cleaning up after LESSOPEN preprocessors
+	onRelease func()
+
 	// For telling the UI it should recheck the --quit-if-one-screen conditions.
 	// Signalled when either highlighting is done or reading is done.
 	maybeDone chan bool
 
 	moreLinesAdded chan bool
+
+	// Closed when more input has been read, or when we're done reading. Unlike
+	// moreLinesAdded this one can be waited for by any number of goroutines,
+	// see waitForInput().
+	inputChanged chan struct{}
 }
 
 // InputLines contains a number of lines from the reader, plus metadata
@@ -56,10 +163,48 @@ type InputLines struct {
 	statusText string
 }
 
+// Get a channel that will be closed when more input has been read, or when
+// we're done reading. Check for what you're waiting for after getting the
+// channel, but before waiting for it, and don't unlock in between, so that no
+// changes are missed.
+func (reader *Reader) inputChangedUnlocked() <-chan struct{} {
+	if reader.inputChanged == nil {
+		reader.inputChanged = make(chan struct{})
+	}
+	return reader.inputChanged
+}
+
+// Wake up everybody waiting for input changes
+func (reader *Reader) signalInputChangedUnlocked() {
+	if reader.inputChanged == nil {
+		// Nobody is waiting
+		return
+	}
+	close(reader.inputChanged)
+	reader.inputChanged = nil
+}
+
+// Wait for a channel from inputChangedUnlocked() to be closed. Returns false if
+// the timeout expires first.
+func waitForInput(inputChanged <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-inputChanged:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
 // Shut down the filter (if any) after we're done reading the file.
 func (reader *Reader) cleanupFilter(fromFilter *exec.Cmd) {
 	defer func() {
 		reader.done.Store(true)
+		reader.Lock()
+		reader.signalInputChangedUnlocked()
+		reader.Unlock()
 		select {
 		case reader.maybeDone <- true:
 		default:
@@ -107,7 +252,7 @@ func (reader *Reader) cleanupFilter(fromFilter *exec.Cmd) {
 		}
 	}
 
-	// FIXME: Report any filter printouts to stderr to the user
+	reader.stderrText = stderrText
 
 	log.Trace("Reader done, filter done")
 }
@@ -116,6 +261,9 @@ func (reader *Reader) cleanupFilter(fromFilter *exec.Cmd) {
 // performance improvement:
 //
 // go test -benchmem -benchtime=10s -run='^$' -bench 'ReadLargeFile'
+//
+// This runs in parallel with reading the file, so that we can show the first
+// lines without waiting for the counting to finish.
 func (reader *Reader) preAllocLines(originalFileName string) {
 	lineCount, err := countLines(originalFileName)
 	if err != nil {
@@ -126,23 +274,23 @@ func (reader *Reader) preAllocLines(originalFileName string) {
 	reader.Lock()
 	defer reader.Unlock()
 
-	if len(reader.lines) == 0 {
-		// We had no lines since before, this is the expected happy path.
-		reader.lines = make([]*Line, 0, lineCount)
-		return
-	}
-
-	// There are already lines in here, this is unexpected.
 	if reader.replaced {
 		// Highlighting already done (because that's how reader.replaced gets
-		// set to true)
+		// set to true), no need to grow anything
 		log.Debug("Highlighting was faster than line counting for a ",
-			len(reader.lines), " lines file, this is unexpected")
-	} else {
-		// Highlighing not done, where the heck did those lines come from?
-		log.Warn("Already had ", len(reader.lines),
-			" lines by the time counting was done, and it's not highlighting")
+			len(reader.lines), " lines file")
+		return
+	}
+
+	if uint64(cap(reader.lines)) >= lineCount {
+		// Already large enough, this happens if reading was faster than
+		// counting
+		return
 	}
+
+	grown := make([]*Line, len(reader.lines), lineCount)
+	copy(grown, reader.lines)
+	reader.lines = grown
 }
 
 // This function will be update the Reader struct in the background.
@@ -150,15 +298,55 @@ func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fro
 	defer reader.cleanupFilter(fromFilter)
 
 	if originalFileName != nil {
-		reader.preAllocLines(*originalFileName)
+		go reader.preAllocLines(*originalFileName)
+	}
+
+	decompressed, err := decompressingReader(stream)
+	if err != nil {
+		reader.Lock()
+		if reader.err == nil {
+			reader.err = fmt.Errorf("error decompressing input stream: %w", err)
+		}
+		reader.Unlock()
+		return
+	}
+
+	buffered := bufio.NewReaderSize(decompressed, _EncodingSniffLength)
+	header, err := peekHeader(buffered)
+	if err != nil {
+		reader.Lock()
+		if reader.err == nil {
+			reader.err = fmt.Errorf("error detecting input stream encoding: %w", err)
+		}
+		reader.Unlock()
+		return
+	}
+
+	var decoded io.Reader
+	if reader.options.encoding == nil && looksBinary(header) {
+		// Show binary input as a hex dump, but keep the text lines around for
+		// toggling back
+		log.Debug("Input looks binary, showing it as a hex dump")
+		reader.Lock()
+		reader.hexDump = newStreamHexDump()
+		reader.showingHex = true
+		reader.Unlock()
+		decoded = &_HexDumpTee{stream: buffered, reader: reader}
+	} else {
+		var detectedEncoding *inputEncoding
+		decoded, detectedEncoding = decodingReader(buffered, header, reader.options)
+		reader.Lock()
+		reader.encoding = detectedEncoding
+		reader.Unlock()
 	}
 
-	bufioReader := bufio.NewReader(stream)
+	bufioReader := bufio.NewReader(decoded)
 	completeLine := make([]byte, 0)
 	t0 := time.Now().UnixNano()
 	for {
 		keepReadingLine := true
 		eof := false
+		failed := false
 
 		var lineBytes []byte
 		var err error
@@ -176,6 +364,7 @@ func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fro
 					reader.err = fmt.Errorf("error reading line from input stream: %w", err)
 				}
 				reader.Unlock()
+				failed = true
 				break
 			}
 
@@ -186,7 +375,7 @@ func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fro
 			break
 		}
 
-		if reader.err != nil {
+		if failed {
 			break
 		}
 
@@ -200,6 +389,8 @@ func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fro
 			break
 		}
 		reader.lines = append(reader.lines, &newLine)
+		reader.bytesRead += int64(len(completeLine)) + 1 // +1 for the newline
+		reader.signalInputChangedUnlocked()
 		reader.Unlock()
 		completeLine = completeLine[:0]
 
@@ -219,23 +410,58 @@ func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fro
 
 // NewReaderFromStream creates a new stream reader
 //
+// Compressed streams will be transparently decompressed, just like zless does.
+//
 // The name can be an empty string ("").
 //
 // If non-empty, the name will be displayed by the pager in the bottom left
 // corner to help the user keep track of what is being paged.
 func NewReaderFromStream(name string, reader io.Reader) *Reader {
-	mReader := newReaderFromStream(reader, nil, nil)
+	mReader := newReaderFromStream(reader, nil, nil, ReaderOptions{})
 	mReader.highlightingDone.Store(true) // No highlighting of streams = nothing left to do = Done!
 
+	mReader.Lock()
 	if len(name) > 0 {
-		mReader.Lock()
 		mReader.name = &name
-		mReader.Unlock()
 	}
+	mReader.table = newTable(name, ReaderOptions{})
+	mReader.Unlock()
 
 	return mReader
 }
 
+// NewHighlightingReaderFromStream creates a new stream reader, which
+// highlights the stream contents while they are being read.
+//
+// The language is guessed from the first lines of the stream. Input that
+// already contains ANSI formatting is not highlighted.
+//
+// Compressed streams will be transparently decompressed, just like zless does.
+//
+// The name can be an empty string ("").
+func NewHighlightingReaderFromStream(name string, stream io.Reader, style chroma.Style, formatter chroma.Formatter) *Reader {
+	return NewHighlightingReaderFromStreamWithOptions(name, stream, style, formatter, ReaderOptions{})
+}
+
+// NewHighlightingReaderFromStreamWithOptions is like
+// NewHighlightingReaderFromStream(), but the encoding, language and such can
+// be forced using ReaderOptions.
+func NewHighlightingReaderFromStreamWithOptions(name string, stream io.Reader, style chroma.Style, formatter chroma.Formatter, options ReaderOptions) *Reader {
+	reader := newReader()
+	reader.options = options
+	if len(name) > 0 {
+		reader.name = &name
+	}
+	reader.table = newTable(name, options)
+
+	go reader.readStream(stream, nil, nil)
+	go reader.highlightIncrementally("", style, formatter)
+	go reader.detectJson(style, formatter)
+	go reader.detectLog()
+
+	return reader
+}
+
 // newReaderFromStream creates a new stream reader
 //
 // originalFileName is used for counting the lines in the file. nil for
@@ -245,12 +471,25 @@ func NewReaderFromStream(name string, reader io.Reader) *Reader {
 //
 // If fromFilter is not nil this method will wait() for it, and effectively
 // takes over ownership for it.
-func newReaderFromStream(reader io.Reader, originalFileName *string, fromFilter *exec.Cmd) *Reader {
+func newReaderFromStream(reader io.Reader, originalFileName *string, fromFilter *exec.Cmd, options ReaderOptions) *Reader {
+	returnMe := newReader()
+	returnMe.options = options
+
+	// FIXME: Make sure that if we panic somewhere inside of this goroutine,
+	// the main program terminates and prints our panic stack trace.
+	go returnMe.readStream(reader, originalFileName, fromFilter)
+
+	return returnMe
+}
+
+// newReader creates an empty not-done Reader, ready for some goroutine to start
+// filling it with lines.
+func newReader() *Reader {
 	done := atomic.Bool{}
 	done.Store(false)
 	highlightingDone := atomic.Bool{}
 	highlightingDone.Store(false)
-	returnMe := Reader{
+	return &Reader{
 		// This needs to be size 1. If it would be 0, and we add more
 		// lines while the pager is processing, the pager would miss
 		// the lines added while it was processing.
@@ -259,12 +498,6 @@ func newReaderFromStream(reader io.Reader, originalFileName *string, fromFilter
 		highlightingDone: &highlightingDone,
 		done:             &done,
 	}
-
-	// FIXME: Make sure that if we panic somewhere inside of this goroutine,
-	// the main program terminates and prints our panic stack trace.
-	go returnMe.readStream(reader, originalFileName, fromFilter)
-
-	return &returnMe
 }
 
 // NewReaderFromText creates a Reader from a block of text.
@@ -302,30 +535,48 @@ func newReaderFromCommand(filename string, filterCommand ...string) (*Reader, er
 	filterWithFilename := append(filterCommand, filename)
 	filter := exec.Command(filterWithFilename[0], filterWithFilename[1:]...)
 
-	filterOut, err := filter.StdoutPipe()
+	filterOut, filterErr, err := startFilter(filter)
 	if err != nil {
 		return nil, err
 	}
 
+	return newReaderFromFilter(filename, filter, filterOut, filterErr, ReaderOptions{}), nil
+}
+
+// startFilter starts a not-yet-started filter command and returns its stdout
+// and stderr streams. The returned stderr stream can be nil.
+func startFilter(filter *exec.Cmd) (io.Reader, io.Reader, error) {
+	filterOut, err := filter.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	filterErr, err := filter.StderrPipe()
 	if err != nil {
 		// The error stream is only used in case of failures, and having it
 		// nil is fine, so just log this and move along.
-		log.Warnf("Stderr not available from %s: %s", filterCommand[0], err.Error())
+		log.Warnf("Stderr not available from %s: %s", filter.Path, err.Error())
 	}
 
 	err = filter.Start()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	reader := newReaderFromStream(filterOut, nil, filter)
+	return filterOut, filterErr, nil
+}
+
+// newReaderFromFilter creates a new reader from the output of a filter started
+// by startFilter(). The reader takes over ownership of the filter and will
+// wait() for it.
+func newReaderFromFilter(name string, filter *exec.Cmd, filterOut io.Reader, filterErr io.Reader, options ReaderOptions) *Reader {
+	reader := newReaderFromStream(filterOut, nil, filter, options)
 	reader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
 	reader.Lock()
-	reader.name = &filename
+	reader.name = &name
 	reader._stderr = filterErr
 	reader.Unlock()
-	return reader, nil
+	return reader
 }
 
 // Duplicate of moar/moar.go:tryOpen
@@ -407,23 +658,60 @@ func countLines(filename string) (uint64, error) {
 
 // NewReaderFromFilename creates a new file reader.
 //
-// The Reader will try to uncompress various compressed file format, and also
-// apply highlighting to the file using Chroma:
-// https://github.com/alecthomas/chroma
+// If the LESSOPEN environment variable is set, the file will be run through
+// that input preprocessor first, just like less does.
+//
+// The Reader will try to uncompress various compressed file formats, detected
+// by their contents rather than by their file names. Uncompressed files will
+// be highlighted using Chroma: https://github.com/alecthomas/chroma
+//
+// Readers created by this function can be reloaded from disk in the pager.
 func NewReaderFromFilename(filename string, style chroma.Style, formatter chroma.Formatter) (*Reader, error) {
+	return NewReaderFromFilenameWithOptions(filename, style, formatter, ReaderOptions{})
+}
+
+// NewReaderFromFilenameWithOptions is like NewReaderFromFilename(), but the
+// encoding, language and such can be forced using ReaderOptions.
+func NewReaderFromFilenameWithOptions(filename string, style chroma.Style, formatter chroma.Formatter, options ReaderOptions) (*Reader, error) {
+	if isDirectory(filename) {
+		return NewReaderFromDirectoryWithOptions(filename, style, formatter, options)
+	}
+
+	reader, err := newReaderFromFilename(filename, style, formatter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	reader.Lock()
+	reader.reloader = func() (*Reader, error) {
+		return NewReaderFromFilenameWithOptions(filename, style, formatter, options)
+	}
+	reader.table = newTable(filename, options)
+	reader.Unlock()
+
+	go reader.detectJson(style, formatter)
+	go reader.detectLog()
+
+	return reader, nil
+}
+
+func newReaderFromFilename(filename string, style chroma.Style, formatter chroma.Formatter, options ReaderOptions) (*Reader, error) {
 	fileError := tryOpen(filename)
 	if fileError != nil {
 		return nil, fileError
 	}
 
-	if strings.HasSuffix(filename, ".gz") {
-		return newReaderFromCommand(filename, "gzip", "-d", "-c")
+	preprocessed, err := newReaderFromLessOpen(filename, options)
+	if err != nil {
+		return nil, err
 	}
-	if strings.HasSuffix(filename, ".bz2") {
-		return newReaderFromCommand(filename, "bzip2", "-d", "-c")
+	if preprocessed != nil {
+		return preprocessed, nil
 	}
-	if strings.HasSuffix(filename, ".xz") {
-		return newReaderFromCommand(filename, "xz", "-d", "-c")
+
+	compressed, err := isCompressedFile(filename)
+	if err != nil {
+		return nil, err
 	}
 
 	stream, err := os.Open(filename)
@@ -431,70 +719,265 @@ func NewReaderFromFilename(filename string, style chroma.Style, formatter chroma
 		return nil, err
 	}
 
-	returnMe := newReaderFromStream(stream, &filename, nil)
-	returnMe.Lock()
-	returnMe.name = &filename
-	returnMe.Unlock()
-
-	go func() {
-		defer func() {
-			returnMe.highlightingDone.Store(true)
-			select {
-			case returnMe.maybeDone <- true:
-			default:
-			}
-
-			log.Trace("Highlighting done")
-		}()
+	var fileEncoding *inputEncoding
+	binary := false
+	if !compressed {
+		header, err := readFileHeader(filename)
+		if err != nil {
+			return nil, err
+		}
+		binary = options.encoding == nil && looksBinary(header)
+		if !binary {
+			fileEncoding = detectHeaderEncoding(header, options)
+		}
 
-		highlighted, err := highlight(filename, false, style, formatter)
+		fileInfo, err := os.Stat(filename)
 		if err != nil {
-			log.Warn("Highlighting failed: ", err)
-			return
+			return nil, err
 		}
+		canIndex := fileEncoding == nil || fileEncoding.asciiCompatible
+		if fileInfo.Size() > MAX_IN_MEMORY_SIZE && canIndex {
+			log.Debugf("Not keeping %s in memory because it is %d bytes large, which is larger than moar's in-memory limit of %d bytes",
+				filename, fileInfo.Size(), MAX_IN_MEMORY_SIZE)
+			returnMe, err := newFileBackedReader(filename, fileEncoding)
+			if err != nil {
+				return nil, err
+			}
+			if !binary {
+				// Picks a lexer for highlighting lines as they are shown
+				returnMe.highlightingDone.Store(false)
+				go returnMe.highlightIncrementally(filename, style, formatter)
+				return returnMe, nil
+			}
 
-		if highlighted == nil {
-			// No highlighting would be done, never mind
-			return
+			returnMe.Lock()
+			returnMe.hexDump = newFileHexDump(returnMe.fileLines.file, fileInfo.Size())
+			returnMe.showingHex = true
+			returnMe.seekableFilename = nil
+			returnMe.Unlock()
+			return returnMe, nil
 		}
+	}
 
-		returnMe.setText(*highlighted)
-	}()
+	if compressed {
+		// Line counting and highlighting won't work on compressed files,
+		// readStream() will do the decompressing.
+		returnMe := newReaderFromStream(stream, nil, nil, options)
+		returnMe.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+		returnMe.Lock()
+		returnMe.name = &filename
+		returnMe.Unlock()
+		return returnMe, nil
+	}
+
+	returnMe := newReaderFromStream(stream, &filename, nil, options)
+	returnMe.Lock()
+	returnMe.name = &filename
+	if fileEncoding == nil && !binary {
+		returnMe.seekableFilename = &filename
+	}
+	returnMe.Unlock()
+
+	if binary {
+		// Highlighting binary files makes no sense
+		returnMe.highlightingDone.Store(true)
+		return returnMe, nil
+	}
+
+	go returnMe.highlightIncrementally(filename, style, formatter)
 
 	return returnMe, nil
 }
 
 // createStatusUnlocked() assumes that its caller is holding the lock
 func (r *Reader) createStatusUnlocked(lastLineOneBased int) string {
+	status := r.createLinesStatusUnlocked(lastLineOneBased)
+	if r.exitStatus != nil {
+		status += "  " + *r.exitStatus
+	}
+	if r.logView != nil && r.logView.minLevel != _LogLevelNone {
+		status += "  level ≥ " + r.logView.minLevel.String()
+	}
+	if r.filterString != "" {
+		status += "  &" + r.filterString
+		if r.filterContext > 0 {
+			status += fmt.Sprintf(" -C%d", r.filterContext)
+		}
+	}
+	if r.filter != nil && r.filter.filtering {
+		status += "  filtering..."
+	}
+	return status + r.watchStatusUnlocked()
+}
+
+// createLinesStatusUnlocked() assumes that its caller is holding the lock
+func (r *Reader) createLinesStatusUnlocked(lastLineOneBased int) string {
 	prefix := ""
-	if r.name != nil {
-		prefix = path.Base(*r.name) + ": "
+	if r.title != nil {
+		prefix = *r.title + ": "
+	} else if r.name != nil {
+		prefix = path.Base(*r.name)
+		if r.encoding != nil {
+			prefix += " [" + r.encoding.name + "]"
+		}
+		if r.showingHex {
+			prefix += " [hex]"
+		}
+		if r.json != nil {
+			prefix += " [json]"
+		}
+		if r.logView != nil {
+			prefix += " [log]"
+		}
+		prefix += ": "
+	} else if r.encoding != nil {
+		prefix = "[" + r.encoding.name + "]: "
+	} else if r.showingHex {
+		prefix = "[hex]: "
+	} else if r.json != nil {
+		prefix = "[json]: "
+	} else if r.logView != nil {
+		prefix = "[log]: "
 	}
 
-	if len(r.lines) == 0 {
+	lineCount := r.lineCountUnlocked()
+	if lineCount == 0 {
 		return prefix + "<empty>"
 	}
 
-	if len(r.lines) == 1 {
+	if r.lineNumbersAreEstimates {
+		totalCount := lineCount + r.lineNumberOffset
+		percent := int(100 * float64(lastLineOneBased+r.lineNumberOffset) / float64(totalCount))
+		return fmt.Sprintf("%s~%s lines (line numbers are estimates)  %d%%",
+			prefix,
+			formatNumber(uint(totalCount)),
+			percent)
+	}
+
+	if lineCount == 1 {
 		return prefix + "1 line  100%"
 	}
 
-	percent := int(100 * float64(lastLineOneBased) / float64(len(r.lines)))
+	percent := int(100 * float64(lastLineOneBased) / float64(lineCount))
 
 	return fmt.Sprintf("%s%s lines  %d%%",
 		prefix,
-		formatNumber(uint(len(r.lines))),
+		formatNumber(uint(lineCount)),
 		percent)
 }
 
+// The line number to show to the user for a line in this Reader
+func (r *Reader) displayLineNumber(lineNumberOneBased int) int {
+	return r.unfilteredLineNumber(lineNumberOneBased) + r.lineNumberOffset
+}
+
 // GetLineCount returns the number of lines available for viewing
 func (r *Reader) GetLineCount() int {
 	r.Lock()
 	defer r.Unlock()
 
+	return r.lineCountUnlocked()
+}
+
+func (r *Reader) lineCountUnlocked() int {
+	if r.filter != nil {
+		r.updateFilterLinesUnlocked()
+		return len(r.filter.lines)
+	}
+
+	return r.unfilteredLineCountUnlocked()
+}
+
+// Like lineCountUnlocked(), but including any lines hidden by our filter
+func (r *Reader) unfilteredLineCountUnlocked() int {
+	if r.showingHex {
+		return r.hexDump.count()
+	}
+
+	if r.json != nil {
+		r.json.update(r.lines)
+		return r.json.lineCount()
+	}
+
+	return r.inputLineCountUnlocked()
+}
+
+// Stop following this Reader's file and re-running its command, close any file
+// we read lines from on demand, and run any LESSCLOSE postprocessor, for when
+// the Reader won't be shown any more
+func (r *Reader) release() {
+	if r.released.Swap(true) {
+		// Already released
+		return
+	}
+
+	r.Lock()
+	onRelease := r.onRelease
+	if r.fileLines != nil {
+		err := r.fileLines.file.Close()
+		if err != nil {
+			log.Debug("Closing released file failed: ", err)
+		}
+	}
+	r.Unlock()
+	if onRelease != nil {
+		onRelease()
+	}
+}
+
+// The number of lines we have read, however we're showing them
+func (r *Reader) inputLineCountUnlocked() int {
+	if r.fileLines != nil {
+		return r.fileLines.count() + len(r.lines)
+	}
+
 	return len(r.lines)
 }
 
+// Get an input line by its zero-based index, which must be in range
+func (r *Reader) inputLineUnlocked(lineIndex int) *Line {
+	if r.fileLines != nil {
+		fileLineCount := r.fileLines.count()
+		if lineIndex < fileLineCount {
+			return r.fileLines.get(lineIndex)
+		}
+		return r.lines[lineIndex-fileLineCount]
+	}
+
+	return r.lines[lineIndex]
+}
+
+// Get a line by its zero-based index, which must be in range
+func (r *Reader) getLineUnlocked(lineIndex int) *Line {
+	if r.filter != nil {
+		unfilteredIndex := r.filter.lines[lineIndex].index
+		if unfilteredIndex < 0 {
+			return &_FilterSeparator
+		}
+		return r.unfilteredLineUnlocked(unfilteredIndex)
+	}
+
+	return r.unfilteredLineUnlocked(lineIndex)
+}
+
+// Like getLineUnlocked(), but indexing all lines, including any lines hidden
+// by our filter
+func (r *Reader) unfilteredLineUnlocked(lineIndex int) *Line {
+	if r.showingHex {
+		return r.hexDump.get(lineIndex)
+	}
+
+	if r.json != nil {
+		return r.json.getLine(lineIndex)
+	}
+
+	if r.logView != nil {
+		return r.logView.line(r.lines, lineIndex).formatted
+	}
+
+	return r.inputLineUnlocked(lineIndex)
+}
+
 // GetLine gets a line. If the requested line number is out of bounds, nil is returned.
 func (r *Reader) GetLine(lineNumberOneBased int) *Line {
 	r.Lock()
@@ -503,10 +986,10 @@ func (r *Reader) GetLine(lineNumberOneBased int) *Line {
 	if lineNumberOneBased < 1 {
 		return nil
 	}
-	if lineNumberOneBased > len(r.lines) {
+	if lineNumberOneBased > r.lineCountUnlocked() {
 		return nil
 	}
-	return r.lines[lineNumberOneBased-1]
+	return r.getLineUnlocked(lineNumberOneBased - 1)
 }
 
 // GetLines gets the indicated lines from the input
@@ -536,7 +1019,8 @@ func (r *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount int) (*
 		firstLineOneBased = 1
 	}
 
-	if len(r.lines) == 0 || wantedLineCount == 0 {
+	lineCount := r.lineCountUnlocked()
+	if lineCount == 0 || wantedLineCount == 0 {
 		return &InputLines{
 				lines:             nil,
 				firstLineOneBased: firstLineOneBased,
@@ -547,9 +1031,10 @@ func (r *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount int) (*
 
 	firstLineZeroBased := firstLineOneBased - 1
 	lastLineZeroBased := nonWrappingAdd(firstLineZeroBased, wantedLineCount-1)
+	r.highlightFocus = firstLineZeroBased
 
-	if lastLineZeroBased >= len(r.lines) {
-		lastLineZeroBased = len(r.lines) - 1
+	if lastLineZeroBased >= lineCount {
+		lastLineZeroBased = lineCount - 1
 	}
 
 	// Prevent reading past the end of the available lines
@@ -564,9 +1049,19 @@ func (r *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount int) (*
 		return r.getLinesUnlocked(firstLineOneBased, wantedLineCount)
 	}
 
-	returnLines := r.lines[firstLineZeroBased : lastLineZeroBased+1]
+	r.highlightFileLinesUnlocked(firstLineZeroBased, lastLineZeroBased)
+
+	var returnLines []*Line
+	if r.fileLines != nil || r.showingHex || r.json != nil || r.logView != nil || r.filter != nil {
+		returnLines = make([]*Line, 0, lastLineZeroBased-firstLineZeroBased+1)
+		for lineIndex := firstLineZeroBased; lineIndex <= lastLineZeroBased; lineIndex++ {
+			returnLines = append(returnLines, r.getLineUnlocked(lineIndex))
+		}
+	} else {
+		returnLines = r.lines[firstLineZeroBased : lastLineZeroBased+1]
+	}
 	overflow := didFit
-	if len(returnLines) != len(r.lines) {
+	if len(returnLines) != lineCount {
 		overflow = didOverflow // We're not returning all available lines
 	}
 
@@ -592,12 +1087,25 @@ func (reader *Reader) setText(text string) {
 		lines = lines[0 : len(lines)-1]
 	}
 
+	reader.setLines(lines)
+}
+
+// Replace reader contents with the given lines and mark as done
+func (reader *Reader) setLines(lines []*Line) {
 	reader.Lock()
 	reader.lines = lines
+	reader.fileLines = nil
 	reader.replaced = true
+	if reader.filter != nil {
+		// All new lines, filter them from the start
+		reader.updateFilterUnlocked()
+	}
 	reader.Unlock()
 
 	reader.done.Store(true)
+	reader.Lock()
+	reader.signalInputChangedUnlocked()
+	reader.Unlock()
 	select {
 	case reader.maybeDone <- true:
 	default:
@@ -0,0 +1,23 @@
+package m
+
+import "github.com/alecthomas/chroma/v2"
+
+// ReaderOptions control how a Reader interprets its input. The zero value
+// guesses everything from the input itself.
+//
+// Options are given when creating a Reader, so different Readers can have
+// different options.
+type ReaderOptions struct {
+	// Set by SetEncoding(), nil means guessing
+	encoding *inputEncoding
+
+	// Set by SetLanguage(), nil means guessing
+	lexer chroma.Lexer
+
+	// Set by SetTableFormat(), 0 means guessing from the file name
+	tableDelimiter rune
+	tablesDisabled bool
+
+	// Set by ForceJson()
+	forceJson bool
+}
@@ -0,0 +1,91 @@
+package m
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+// Options apply to the Reader they are given to, other Readers keep guessing
+func TestReaderOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		set   func(options *ReaderOptions) error
+
+		checkWithOption    func(t *testing.T, reader *Reader)
+		checkWithoutOption func(t *testing.T, reader *Reader)
+	}{
+		{
+			name: "encoding",
+			// Would have been guessed as windows-1252 otherwise
+			input: "\xa4uro\n",
+			set: func(options *ReaderOptions) error {
+				return options.SetEncoding("ISO-8859-15")
+			},
+			checkWithOption: func(t *testing.T, reader *Reader) {
+				assert.DeepEqual(t, readLines(t, reader), []string{"€uro"})
+			},
+			checkWithoutOption: func(t *testing.T, reader *Reader) {
+				assert.DeepEqual(t, readLines(t, reader), []string{"¤uro"})
+			},
+		},
+		{
+			name: "language",
+			// Not guessable, see TestPickLexer()
+			input: "print('hello')\n",
+			set: func(options *ReaderOptions) error {
+				return options.SetLanguage("python")
+			},
+			checkWithOption: func(t *testing.T, reader *Reader) {
+				assert.Assert(t, strings.Contains(reader.GetLine(1).raw, "\x1b["), reader.GetLine(1).raw)
+			},
+			checkWithoutOption: func(t *testing.T, reader *Reader) {
+				assert.Equal(t, reader.GetLine(1).raw, "print('hello')")
+			},
+		},
+		{
+			name: "JSON",
+			// Shown as a log line otherwise, see TestJsonLogsAreNotJson()
+			input: `{"level": "info", "msg": "hello"}`,
+			set: func(options *ReaderOptions) error {
+				options.ForceJson(true)
+				return nil
+			},
+			checkWithOption: func(t *testing.T, reader *Reader) {
+				waitFor(t, "Input never shown as JSON", reader.isShowingJson)
+				assert.Assert(t, !reader.isShowingLog())
+			},
+			checkWithoutOption: func(t *testing.T, reader *Reader) {
+				waitFor(t, "Input never shown as log lines", reader.isShowingLog)
+				assert.Assert(t, !reader.isShowingJson())
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var options ReaderOptions
+			assert.NilError(t, test.set(&options))
+
+			withOption := NewHighlightingReaderFromStreamWithOptions("", strings.NewReader(test.input),
+				*styles.Get("native"), formatters.TTY16m, options)
+			assert.NilError(t, withOption._wait())
+			test.checkWithOption(t, withOption)
+
+			withoutOption := NewHighlightingReaderFromStream("", strings.NewReader(test.input),
+				*styles.Get("native"), formatters.TTY16m)
+			assert.NilError(t, withoutOption._wait())
+			test.checkWithoutOption(t, withoutOption)
+		})
+	}
+}
+
+func TestInvalidReaderOptions(t *testing.T) {
+	var options ReaderOptions
+	assert.Assert(t, options.SetEncoding("no such encoding") != nil)
+	assert.Assert(t, options.SetLanguage("no such language") != nil)
+}
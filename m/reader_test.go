@@ -1,6 +1,7 @@
 package m
 
 import (
+	"bytes"
 	"math"
 	"os"
 	"os/exec"
@@ -9,12 +10,38 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/chroma/v2/formatters"
 	"github.com/alecthomas/chroma/v2/styles"
 	"gotest.tools/v3/assert"
 )
 
+// How often to check whether something we're waiting for in a test has happened
+const _TestPollInterval = 5 * time.Millisecond
+
+// Wait up to a few seconds for something to happen in the background. Returns
+// false if it didn't.
+func eventually(happened func() bool) bool {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(_TestPollInterval) {
+		if happened() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Wait for something to happen in the background, fail the test with the given
+// message if that doesn't happen within a few seconds
+func waitFor(t *testing.T, failureMessage string, happened func() bool) {
+	t.Helper()
+
+	if !eventually(happened) {
+		t.Fatal(failureMessage)
+	}
+}
+
 func testGetLineCount(t *testing.T, reader *Reader) {
 	if strings.Contains(*reader.name, "compressed") {
 		// We are no good at counting lines of compressed files, never mind
@@ -151,22 +178,6 @@ func (r *Reader) _wait() error {
 
 func TestGetLines(t *testing.T) {
 	for _, file := range getTestFiles() {
-		if strings.HasSuffix(file, ".xz") {
-			_, err := exec.LookPath("xz")
-			if err != nil {
-				t.Log("Not testing xz compressed file, xz not found in $PATH: ", file)
-				continue
-			}
-		}
-
-		if strings.HasSuffix(file, ".bz2") {
-			_, err := exec.LookPath("bzip2")
-			if err != nil {
-				t.Log("Not testing bzip2 compressed file, bzip2 not found in $PATH: ", file)
-				continue
-			}
-		}
-
 		reader, err := NewReaderFromFilename(file, *styles.Get("native"), formatters.TTY16m)
 		if err != nil {
 			t.Errorf("Error opening file <%s>: %s", file, err.Error())
@@ -196,6 +207,12 @@ func testHighlightingLineCount(t *testing.T, filenameWithPath string) {
 	if strings.HasSuffix(filenameWithPath, ".gz") {
 		return
 	}
+	if strings.HasSuffix(filenameWithPath, ".zst") {
+		return
+	}
+	if strings.HasSuffix(filenameWithPath, ".lz4") {
+		return
+	}
 
 	// Load the unformatted file
 	rawBytes, err := os.ReadFile(filenameWithPath)
@@ -312,20 +329,48 @@ func testCompressedFile(t *testing.T, filename string) {
 
 func TestCompressedFiles(t *testing.T) {
 	testCompressedFile(t, "compressed.txt.gz")
+	testCompressedFile(t, "compressed.txt.bz2")
+	testCompressedFile(t, "compressed.txt.xz")
+	testCompressedFile(t, "compressed.txt.zst")
+	testCompressedFile(t, "compressed.txt.lz4")
+}
 
-	_, err := exec.LookPath("bzip2")
-	if err == nil {
-		testCompressedFile(t, "compressed.txt.bz2")
-	} else {
-		t.Log("WARNING: bzip2 not found in path, not testing automatic bzip2 decompression")
-	}
+// Compression should be detected by contents, not by file name
+func TestCompressedFileWithoutSuffix(t *testing.T) {
+	compressed, err := os.ReadFile(getSamplesDir() + "/compressed.txt.gz")
+	assert.NilError(t, err)
 
-	_, err = exec.LookPath("xz")
-	if err == nil {
-		testCompressedFile(t, "compressed.txt.xz")
-	} else {
-		t.Log("WARNING: xz not found in path, not testing automatic xz decompression")
-	}
+	filename := t.TempDir() + "/no-suffix"
+	assert.NilError(t, os.WriteFile(filename, compressed, 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	lines, _ := reader.GetLines(1, 5)
+	assert.Equal(t, lines.lines[0].Plain(nil), "This is a compressed file")
+}
+
+// Text starting with "BZh" isn't necessarily bzip2 compressed
+func TestBzip2LookalikeText(t *testing.T) {
+	assert.Assert(t, !isCompressed([]byte("BZhello")))
+	assert.Assert(t, isCompressed([]byte("BZh91AY&SY")))
+
+	reader := NewReaderFromStream("", strings.NewReader("BZhello\nworld"))
+	assert.NilError(t, reader._wait())
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "BZhello")
+}
+
+// Just like zless, we should decompress compressed data on stdin
+func TestCompressedStream(t *testing.T) {
+	compressed, err := os.ReadFile(getSamplesDir() + "/compressed.txt.xz")
+	assert.NilError(t, err)
+
+	reader := NewReaderFromStream("", bytes.NewReader(compressed))
+	assert.NilError(t, reader._wait())
+
+	lines, _ := reader.GetLines(1, 5)
+	assert.Equal(t, lines.lines[0].Plain(nil), "This is a compressed file")
 }
 
 func TestFilterNotInstalled(t *testing.T) {
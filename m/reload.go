@@ -0,0 +1,194 @@
+package m
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// For how long lines that changed when reloading are marked
+const _ChangedLinesMarkDuration = 2 * time.Second
+
+// Lines that changed when reloading, highlighted for a little while
+type _ChangedLines struct {
+	reader      *Reader
+	lineNumbers map[int]bool
+}
+
+// A reload waiting for the new Reader to finish, so that we can tell which
+// lines changed
+type _PendingReload struct {
+	previous *Reader
+	reloaded *Reader
+}
+
+// Sent when it's time to stop highlighting the changed lines in some Reader
+type eventClearChangedLines struct {
+	reader *Reader
+}
+
+// Create a new Reader reading the same file as this one.
+//
+// Returns nil if this Reader can't be reloaded, because it wasn't read from a
+// file.
+func (reader *Reader) reload() (*Reader, error) {
+	reader.Lock()
+	reloader := reader.reloader
+	followingByName := reader.followingByName
+	watchInterval := reader.watchInterval
+	filterString := reader.filterString
+	filterContext := reader.filterContext
+	minLogLevel := _LogLevelNone
+	if reader.logView != nil {
+		minLogLevel = reader.logView.minLevel
+	}
+	reader.Unlock()
+
+	if reloader == nil {
+		return nil, nil
+	}
+
+	reloaded, err := reloader()
+	if err != nil {
+		return nil, err
+	}
+
+	if followingByName {
+		reloaded.FollowByName()
+	}
+
+	if watchInterval > 0 {
+		reloaded.Watch(watchInterval)
+	}
+
+	if minLogLevel != _LogLevelNone {
+		reloaded.setMinLogLevel(minLogLevel)
+	}
+
+	if filterString != "" {
+		reloaded.setFilter(filterString, filterContext)
+	}
+
+	return reloaded, nil
+}
+
+// Re-read the current file from disk. The line number and search pattern are
+// kept, and lines that changed are marked for a little while once the new
+// contents have been read.
+func (p *Pager) reload() {
+	if p.isShowingHelp {
+		return
+	}
+
+	p.endTailPreview()
+
+	reloaded, err := p.reader.reload()
+	if err != nil {
+		log.Warn("Reloading failed: ", err)
+		return
+	}
+	if reloaded == nil {
+		log.Debug("Not reloading, current Reader isn't from a file")
+		return
+	}
+
+	if p.TargetLineNumberOneBased == 0 {
+		// The new Reader has no lines yet, scroll to our current line as soon
+		// as it does
+		p.TargetLineNumberOneBased = p.lineNumberOneBased()
+	}
+
+	p.own(reloaded)
+	previous := p.reader
+	p.releaseIfOwned(previous)
+	p.moveMarks(previous, reloaded)
+	p.reader = reloaded
+	if len(p.parentViews) == 0 {
+		// Not in a view opened from a directory listing
+		p.readers[p.currentFileIndex] = reloaded
+	}
+	p.scrollPosition = newScrollPosition("Pager scroll position")
+	p.pendingReload = &_PendingReload{previous: previous, reloaded: reloaded}
+	p.changedLines = nil
+
+	if p.screen != nil {
+		p.watchReader(reloaded)
+	}
+}
+
+// Once a reloaded Reader is done, figure out which lines changed
+func (p *Pager) maybeMarkChangedLines() {
+	if p.pendingReload == nil {
+		return
+	}
+
+	reloaded := p.pendingReload.reloaded
+	if !reloaded.done.Load() || !reloaded.highlightingDone.Load() {
+		return
+	}
+
+	lineNumbers := changedLineNumbers(p.pendingReload.previous, reloaded)
+	p.pendingReload = nil
+	if len(lineNumbers) == 0 {
+		return
+	}
+
+	p.changedLines = &_ChangedLines{
+		reader:      reloaded,
+		lineNumbers: lineNumbers,
+	}
+
+	if p.screen == nil {
+		// No main loop to tell about when we're done
+		return
+	}
+	screen := p.screen
+	time.AfterFunc(_ChangedLinesMarkDuration, func() {
+		// Non-blocking, nobody is reading events after the pager has quit
+		select {
+		case screen.Events() <- eventClearChangedLines{reader: reloaded}:
+		default:
+			log.Debug("Not clearing changed lines, the event queue is full")
+		}
+	})
+}
+
+// Returns the one-based input line numbers of all lines in current that weren't
+// in previous.
+//
+// Returns nil for file backed Readers, comparing those would take too long.
+func changedLineNumbers(previous *Reader, current *Reader) map[int]bool {
+	previousLines := map[string]bool{}
+	previous.Lock()
+	if previous.fileLines != nil {
+		previous.Unlock()
+		return nil
+	}
+	for _, line := range previous.lines {
+		previousLines[line.Plain(nil)] = true
+	}
+	previous.Unlock()
+
+	changed := map[int]bool{}
+	current.Lock()
+	defer current.Unlock()
+	if current.fileLines != nil {
+		return nil
+	}
+	for index, line := range current.lines {
+		if !previousLines[line.Plain(nil)] {
+			changed[index+1] = true
+		}
+	}
+
+	return changed
+}
+
+// Should this line be marked as changed by a reload?
+func (p *Pager) isChangedLine(lineNumberOneBased int) bool {
+	if p.changedLines == nil || p.changedLines.reader != p.reader {
+		return false
+	}
+
+	return p.changedLines.lineNumbers[p.reader.inputLineNumber(lineNumberOneBased)]
+}
@@ -0,0 +1,133 @@
+package m
+
+import (
+	"os"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestChangedLineNumbers(t *testing.T) {
+	previous := NewReaderFromText("previous", "a\nb\nc")
+	current := NewReaderFromText("current", "a\nnew\nb\nc\nnewer")
+
+	assert.DeepEqual(t, changedLineNumbers(previous, current), map[int]bool{2: true, 5: true})
+}
+
+func TestReload(t *testing.T) {
+	filename := t.TempDir() + "/reload.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("1\n2\n3\n4\n5\n6\n7\n8\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.ShowLineNumbers = false
+	pager.screen = twin.NewFakeScreen(20, 3)
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	pager.onRune('j')
+	pager.onRune('j')
+	assert.Equal(t, pager.lineNumberOneBased(), 3)
+
+	pager.searchString = "5"
+	pager.searchPattern = toPattern(pager.searchString)
+
+	assert.NilError(t, os.WriteFile(filename, []byte("1\n2\n3\nfour\n5\n6\n7\n8\n"), 0o600))
+	pager.onRune('R')
+	assert.Assert(t, pager.reader != reader)
+	assert.Assert(t, pager.readers[0] == pager.reader)
+	assert.NilError(t, pager.reader._wait())
+
+	// This is what the main loop does when the new Reader reports progress
+	assert.Equal(t, pager.TargetLineNumberOneBased, 3)
+	pager.maybeMarkChangedLines()
+
+	assert.Equal(t, pager.reader.GetLine(4).Plain(nil), "four")
+	assert.Equal(t, pager.isChangedLine(3), false)
+	assert.Equal(t, pager.isChangedLine(4), true)
+	assert.Equal(t, pager.searchString, "5")
+
+	// Switching to some other Reader should hide the marks
+	pager.reader = NewReaderFromText("other", "four")
+	assert.Equal(t, pager.isChangedLine(4), false)
+}
+
+func TestReloadKeepsMarks(t *testing.T) {
+	filename := t.TempDir() + "/reload.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("1\n2\n3\n4\n5\n6\n7\n8\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(20, 3)
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(4, "TestReloadKeepsMarks")
+	pager.onRune('m')
+	pager.onRune('a')
+
+	pager.onRune('R')
+	assert.Assert(t, pager.reader != reader)
+	assert.NilError(t, pager.reader._wait())
+	assert.Equal(t, pager.markLineNumberOneBased('a'), 4)
+}
+
+func TestReloadKeepsLogLevel(t *testing.T) {
+	filename := t.TempDir() + "/reload.log"
+	assert.NilError(t, os.WriteFile(filename, []byte(_TestLog), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m)
+	assert.NilError(t, err)
+	waitFor(t, "Input never shown as log lines", reader.isShowingLog)
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	assert.NilError(t, reader._wait())
+
+	// Hide everything but errors
+	pager.onRune('v')
+	pager.onRune('v')
+	pager.onRune('v')
+	pager.onRune('v')
+	assert.Equal(t, reader.GetLineCount(), 3)
+
+	pager.onRune('R')
+	assert.Assert(t, pager.reader != reader)
+	assert.NilError(t, pager.reader._wait())
+	waitFor(t, "Reloaded input never shown as log lines", pager.reader.isShowingLog)
+	assert.DeepEqual(t, readLines(t, pager.reader), []string{
+		"10:02 ERROR it broke",
+		"    at main.go:12",
+		"10:04 ERROR broke again",
+	})
+}
+
+func TestChangedLinesWhenFiltering(t *testing.T) {
+	reader := NewReaderFromText("filtered", "a\nb\nc\nd")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(20, 5)
+	pager.redraw("")
+
+	pager.changedLines = &_ChangedLines{reader: reader, lineNumbers: map[int]bool{4: true}}
+	typeFilter(pager, "[bd]")
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "d")
+	assert.Equal(t, pager.isChangedLine(1), false)
+	assert.Equal(t, pager.isChangedLine(2), true)
+	assert.Equal(t, pager.isChangedLine(4), false)
+}
+
+func TestReloadStream(t *testing.T) {
+	reader := NewReaderFromText("stream", "a")
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(20, 3)
+
+	// Nothing to reload from, this should be a no-op
+	pager.onRune('R')
+	assert.Assert(t, pager.reader == reader)
+}
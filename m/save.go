@@ -0,0 +1,273 @@
+package m
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// How often to update the progress shown while saving
+const _SaveProgressInterval = 100 * time.Millisecond
+
+// How many lines to save before letting others at the Reader again
+const _SaveChunkSize = 1000
+
+// How many bytes to copy between progress updates
+const _SaveCopySize = 1024 * 1024
+
+func (p *Pager) addSaveFooter() {
+	contents := "plain text"
+	if p.saveRaw {
+		contents = "raw input"
+	}
+
+	p.addPromptFooter(fmt.Sprintf("Save %s (TAB to toggle) to: %s", contents, p.saveFilename))
+}
+
+func (p *Pager) onSaveKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEnter:
+		p.mode = _Viewing
+		if strings.TrimSpace(p.saveFilename) == "" {
+			return
+		}
+		p.message = p.save(expandHome(p.saveFilename), p.saveRaw)
+
+	case twin.KeyEscape:
+		p.mode = _Viewing
+
+	case twin.KeyBackspace, twin.KeyDelete:
+		if len(p.saveFilename) == 0 {
+			return
+		}
+
+		p.saveFilename = removeLastChar(p.saveFilename)
+
+	default:
+		log.Tracef("Unhandled save key event %v", key)
+	}
+}
+
+func (p *Pager) onSaveRune(char rune) {
+	if char == '\t' {
+		p.saveRaw = !p.saveRaw
+		return
+	}
+
+	p.saveFilename += string(char)
+}
+
+// Turn "~/x" into "/home/user/x", since there's no shell doing that for us
+func expandHome(filename string) string {
+	if !strings.HasPrefix(filename, "~/") {
+		return filename
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Debug("Home directory not found: ", err)
+		return filename
+	}
+
+	return filepath.Join(home, filename[2:])
+}
+
+// Open a new file and write the lines we have so far to it in the background,
+// either the input the way we read it (raw) or the lines as shown, as plain
+// text. Progress is shown in the status bar.
+//
+// If we're still reading, lines arriving while saving are not included.
+//
+// Returns a message for the status bar.
+func (p *Pager) save(filename string, raw bool) string {
+	// Don't clobber anything the user might want to keep
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return "Saving failed: " + err.Error()
+	}
+
+	reader := p.reader
+	go func() {
+		lastProgress := time.Now()
+		progress := func(writtenCount int, lineCount int) {
+			if time.Since(lastProgress) < _SaveProgressInterval {
+				return
+			}
+			lastProgress = time.Now()
+
+			message := fmt.Sprintf("Saving to %s: %s of %s lines...",
+				filename, formatNumber(uint(writtenCount)), formatNumber(uint(lineCount)))
+			p.post(func(p *Pager) {
+				p.message = message
+			})
+		}
+
+		message := saveTo(file, reader, raw, progress)
+		p.post(func(p *Pager) {
+			p.message = message
+		})
+	}()
+
+	return "Saving to " + filename + "..."
+}
+
+// Write the Reader's lines to a file and close it.
+//
+// Returns a message for the status bar.
+func saveTo(file *os.File, reader *Reader, raw bool, progress func(writtenCount int, lineCount int)) string {
+	writer := bufio.NewWriter(file)
+	var writtenCount int
+	var err error
+	if raw {
+		writtenCount, err = reader.writeInput(writer, progress)
+	} else {
+		writtenCount, err = writePlain(writer, reader, progress)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "Saving failed: " + err.Error()
+	}
+
+	return fmt.Sprintf("Saved %s lines to %s", formatNumber(uint(writtenCount)), file.Name())
+}
+
+// Write the lines as shown, as plain text
+func writePlain(writer *bufio.Writer, reader *Reader, progress func(writtenCount int, lineCount int)) (int, error) {
+	lineCount := reader.GetLineCount()
+	for lineNumber := 1; lineNumber <= lineCount; lineNumber++ {
+		line := reader.GetLine(lineNumber)
+		if line == nil {
+			// The Reader has been emptied, by a reload for example
+			return lineNumber - 1, nil
+		}
+
+		_, err := writer.WriteString(line.Plain(&lineNumber))
+		if err == nil {
+			err = writer.WriteByte('\n')
+		}
+		if err != nil {
+			return lineNumber - 1, err
+		}
+		progress(lineNumber, lineCount)
+	}
+
+	return lineCount, nil
+}
+
+// Write the input we have read so far, the way we read it. Highlighting we
+// added ourselves is left out, and the hex dump, JSON and other views don't
+// affect what gets written.
+//
+// Returns how many input lines were written.
+func (r *Reader) writeInput(writer io.Writer, progress func(writtenCount int, lineCount int)) (int, error) {
+	r.Lock()
+	hexDump := r.hexDump
+	var hexData []byte
+	if hexDump != nil {
+		hexData = hexDump.data
+	}
+	fileLines := r.fileLines
+	fileLineCount := 0
+	var fileEnd int64
+	if fileLines != nil {
+		fileLineCount = fileLines.count()
+		fileEnd = fileLines.end
+	}
+	lineCount := r.inputLineCountUnlocked()
+	r.Unlock()
+
+	if hexDump != nil {
+		// Binary input, write the exact bytes
+		var source io.Reader = bytes.NewReader(hexData)
+		size := int64(len(hexData))
+		if hexDump.file != nil {
+			size = hexDump.fileSize
+			source = io.NewSectionReader(hexDump.file, 0, size)
+		}
+		return lineCount, copyWithProgress(writer, source, size, func(copiedCount int64) {
+			progress(int(copiedCount*int64(lineCount)/size), lineCount)
+		})
+	}
+
+	if fileLines != nil {
+		// Copy the file's bytes rather than decoding and re-encoding them
+		err := copyWithProgress(writer, io.NewSectionReader(fileLines.file, 0, fileEnd), fileEnd, func(copiedCount int64) {
+			progress(int(copiedCount*int64(fileLineCount)/fileEnd), lineCount)
+		})
+		if err != nil {
+			return 0, err
+		}
+		if fileEnd > 0 && lineCount > fileLineCount && !endsWithNewline(fileLines.file, fileEnd) {
+			_, err = io.WriteString(writer, "\n")
+			if err != nil {
+				return fileLineCount, err
+			}
+		}
+	}
+
+	// Take the lock for one chunk of lines at a time, highlighting replaces
+	// lines while we're writing
+	for chunkStart := fileLineCount; chunkStart < lineCount; chunkStart += _SaveChunkSize {
+		chunkEnd := chunkStart + _SaveChunkSize
+		if chunkEnd > lineCount {
+			chunkEnd = lineCount
+		}
+
+		chunk := make([]string, 0, chunkEnd-chunkStart)
+		r.Lock()
+		for lineIndex := chunkStart; lineIndex < chunkEnd; lineIndex++ {
+			chunk = append(chunk, r.inputLineUnlocked(lineIndex).input())
+		}
+		r.Unlock()
+
+		for chunkIndex, line := range chunk {
+			_, err := io.WriteString(writer, line+"\n")
+			if err != nil {
+				return chunkStart + chunkIndex, err
+			}
+		}
+		progress(chunkEnd, lineCount)
+	}
+
+	return lineCount, nil
+}
+
+func copyWithProgress(writer io.Writer, source io.Reader, size int64, progress func(copiedCount int64)) error {
+	var copiedCount int64
+	for copiedCount < size {
+		chunkSize := size - copiedCount
+		if chunkSize > _SaveCopySize {
+			chunkSize = _SaveCopySize
+		}
+
+		copied, err := io.CopyN(writer, source, chunkSize)
+		copiedCount += copied
+		if err != nil {
+			return err
+		}
+		progress(copiedCount)
+	}
+
+	return nil
+}
+
+func endsWithNewline(file *os.File, end int64) bool {
+	lastByte := make([]byte, 1)
+	_, err := file.ReadAt(lastByte, end-1)
+	return err == nil && lastByte[0] == '\n'
+}
@@ -0,0 +1,124 @@
+package m
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func typeSaveFilename(pager *Pager, filename string) {
+	for _, char := range filename {
+		pager.onRune(char)
+	}
+	pager.onKey(twin.KeyEnter)
+}
+
+// Saving happens in the background, wait for it to finish
+func waitForSaved(t *testing.T, pager *Pager) string {
+	waitFor(t, "Saving never finished", func() bool {
+		pager.runPendingCalls()
+		return strings.HasPrefix(pager.message, "Saved ") || strings.HasPrefix(pager.message, "Saving failed: ")
+	})
+	return pager.message
+}
+
+func readFile(t *testing.T, filename string) string {
+	contents, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	return string(contents)
+}
+
+func TestSavePlain(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "saved.txt")
+	pager := NewPager(NewReaderFromText("colors", "\x1b[31mred\x1b[m\nplain"))
+
+	pager.onRune('s')
+	assert.Equal(t, pager.mode, _Saving)
+	typeSaveFilename(pager, filename)
+
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.Equal(t, waitForSaved(t, pager), "Saved 2 lines to "+filename)
+	assert.Equal(t, readFile(t, filename), "red\nplain\n")
+}
+
+func TestSaveRaw(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "saved.txt")
+	pager := NewPager(NewReaderFromText("colors", "\x1b[31mred\x1b[m\nplain"))
+
+	pager.onRune('s')
+	pager.onRune('\t')
+	typeSaveFilename(pager, filename)
+
+	assert.Equal(t, waitForSaved(t, pager), "Saved 2 lines to "+filename)
+	assert.Equal(t, readFile(t, filename), "\x1b[31mred\x1b[m\nplain\n")
+}
+
+// Raw saves should contain the input, not our own highlighting
+func TestSaveRawHighlighted(t *testing.T) {
+	input := "package main\n\nfunc main() {\n\tprintln(\"hej\")\n}\n"
+	reader := NewHighlightingReaderFromStream("test.go", strings.NewReader(input), *styles.Get("native"), formatters.TTY16m)
+	waitFor(t, "Never highlighted", func() bool {
+		line := reader.GetLine(1)
+		return line != nil && strings.Contains(line.raw, "\x1b[")
+	})
+
+	filename := filepath.Join(t.TempDir(), "saved.go")
+	pager := NewPager(reader)
+	assert.Equal(t, pager.save(filename, true), "Saving to "+filename+"...")
+	assert.Equal(t, waitForSaved(t, pager), "Saved 5 lines to "+filename)
+	assert.Equal(t, readFile(t, filename), input)
+}
+
+// Raw saves of large files should be byte for byte copies
+func TestSaveRawFile(t *testing.T) {
+	input := "windows\r\nno newline at the end"
+	sourceName := filepath.Join(t.TempDir(), "large.txt")
+	assert.NilError(t, os.WriteFile(sourceName, []byte(input), 0o666))
+	reader, err := newFileBackedReader(sourceName, nil)
+	assert.NilError(t, err)
+	defer reader.release()
+	assert.Assert(t, reader.waitForDone())
+
+	filename := filepath.Join(t.TempDir(), "saved.txt")
+	pager := NewPager(reader)
+	pager.save(filename, true)
+	assert.Equal(t, waitForSaved(t, pager), "Saved 2 lines to "+filename)
+	assert.Equal(t, readFile(t, filename), input)
+}
+
+func TestSaveDoesNotOverwrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "saved.txt")
+	assert.NilError(t, os.WriteFile(filename, []byte("precious"), 0o666))
+	pager := NewPager(NewReaderFromText("text", "new"))
+
+	message := pager.save(filename, false)
+	assert.Assert(t, strings.HasPrefix(message, "Saving failed: "), message)
+	assert.Equal(t, readFile(t, filename), "precious")
+}
+
+func TestSaveWhileReading(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+
+	reader := NewReaderFromStream("", pipeReader)
+	_, err := pipeWriter.Write([]byte("first\nsecond\n"))
+	assert.NilError(t, err)
+
+	waitFor(t, "Lines never read", func() bool {
+		return reader.GetLineCount() >= 2
+	})
+	assert.Assert(t, !reader.done.Load())
+
+	filename := filepath.Join(t.TempDir(), "saved.txt")
+	pager := NewPager(reader)
+	pager.save(filename, false)
+	assert.Equal(t, waitForSaved(t, pager), "Saved 2 lines to "+filename)
+	assert.Equal(t, readFile(t, filename), "first\nsecond\n")
+}
@@ -66,14 +66,49 @@ func (p *Pager) redraw(spinner string) overflowState {
 	case _GotoLine:
 		p.addGotoLineFooter()
 
+	case _ColonCommand:
+		p.addColonCommandFooter()
+
+	case _SettingMark:
+		p.addSetMarkFooter()
+
+	case _JumpingToMark:
+		p.addJumpToMarkFooter()
+
+	case _PickingPipeRange:
+		p.addPipeRangeFooter()
+
+	case _TypingPipeCommand:
+		p.addPipeCommandFooter()
+
+	case _Saving:
+		p.addSaveFooter()
+
+	case _Filtering:
+		p.addFilterFooter()
+
 	case _Viewing:
 		helpText := "Press 'ESC' / 'q' to exit, '/' to search, '?' for help"
-		if p.isShowingHelp {
+		if p.isShowingHelp && p.reader == _HelpReader {
 			helpText = "Press 'ESC' / 'q' to exit help, '/' to search"
+		} else if p.isShowingHelp || len(p.parentViews) > 0 {
+			helpText = "Press 'ESC' / 'q' to go back, '/' to search"
+		}
+		if p.reader.directory != nil && !p.isShowingHelp {
+			helpText = "Press RETURN to open, " + helpText[len("Press "):]
+		} else if p.reader.isShowingJson() && !p.isShowingHelp {
+			helpText = "Press RETURN to fold / unfold, " + helpText[len("Press "):]
+		}
+		if p.message != "" {
+			helpText = p.message
 		}
 
 		if p.ShowStatusBar {
-			p.setFooter(statusText + spinner + "  " + helpText)
+			footer := statusText + p.fileNumberStatus() + p.errorStatus() + spinner + "  " + helpText
+			if p.StatusBarText != nil {
+				footer = p.StatusBarText(p, footer)
+			}
+			p.setFooter(footer)
 		}
 
 	default:
@@ -95,9 +130,13 @@ func (p *Pager) renderScreenLines() (lines [][]twin.Cell, statusText string, ove
 	if len(renderedLines) == 0 {
 		return
 	}
+	p.markCursor(renderedLines)
 
 	// Construct the screen lines to return
-	screenLines := make([][]twin.Cell, 0, len(renderedLines))
+	screenLines := make([][]twin.Cell, 0, len(renderedLines)+1)
+	if p.hasFrozenHeader() {
+		screenLines = append(screenLines, p.renderTableHeader())
+	}
 	for _, renderedLine := range renderedLines {
 		screenLines = append(screenLines, renderedLine.cells)
 
@@ -130,7 +169,7 @@ func (p *Pager) renderLines() ([]renderedLine, string, overflowState) {
 	wantedLineCount := p.visibleHeight()
 
 	screenOverflow := didFit
-	if p.lineNumberOneBased() > 1 {
+	if p.lineNumberOneBased() > p.firstScrollingLineOneBased() {
 		// We're scrolled down, meaning everything is not visible on screen
 		screenOverflow = didOverflow
 	}
@@ -144,6 +183,7 @@ func (p *Pager) renderLines() ([]renderedLine, string, overflowState) {
 		// This is not the whole input
 		screenOverflow = didOverflow
 	}
+	p.measureTableRows(inputLines.lines, inputLines.firstLineOneBased)
 
 	allLines := make([]renderedLine, 0)
 	for lineIndex, line := range inputLines.lines {
@@ -200,7 +240,29 @@ func (p *Pager) renderLines() ([]renderedLine, string, overflowState) {
 // lineNumber and numberPrefixLength are required for knowing how much to
 // indent, and to (optionally) render the line number.
 func (p *Pager) renderLine(line *Line, lineNumber int, scrollPosition scrollPositionInternal) ([]renderedLine, overflowState) {
-	highlighted := line.HighlightedTokens(p.linePrefix, p.searchPattern, &lineNumber)
+	line = p.tableRow(line, lineNumber)
+
+	// When filtering, highlight what the filter matched unless we're searching
+	filtered := p.reader.filteredLine(lineNumber)
+	highlightPattern := p.searchPattern
+	if highlightPattern == nil && filtered.accepted {
+		highlightPattern = p.reader.filterHighlightPattern()
+	}
+
+	highlighted := line.HighlightedTokens(p.linePrefix, highlightPattern, &lineNumber)
+	if !filtered.accepted {
+		// Context lines and separators around filter matches
+		for i := range highlighted.Cells {
+			highlighted.Cells[i].Style = highlighted.Cells[i].Style.WithAttr(twin.AttrDim)
+		}
+	}
+	if p.isChangedLine(lineNumber) {
+		// Make changed lines stand out until the mark times out
+		for i := range highlighted.Cells {
+			highlighted.Cells[i].Style = highlighted.Cells[i].Style.WithAttr(twin.AttrReverse)
+		}
+	}
+	p.markWatchChanges(highlighted.Cells, line, lineNumber)
 	var wrapped [][]twin.Cell
 	overflow := didFit
 	if p.WrapLongLines {
@@ -215,10 +277,12 @@ func (p *Pager) renderLine(line *Line, lineNumber int, scrollPosition scrollPosi
 		overflow = didOverflow
 	}
 
+	displayedLineNumber := p.reader.displayLineNumber(lineNumber)
 	rendered := make([]renderedLine, 0)
 	for wrapIndex, inputLinePart := range wrapped {
-		visibleLineNumber := &lineNumber
-		if wrapIndex > 0 {
+		visibleLineNumber := &displayedLineNumber
+		if wrapIndex > 0 || filtered.index < 0 {
+			// Separators have no line number
 			visibleLineNumber = nil
 		}
 
@@ -11,7 +11,7 @@ import (
 )
 
 func testHorizontalCropping(t *testing.T, contents string, firstIndex int, lastIndex int, expected string, expectedOverflow overflowState) {
-	pager := NewPager(nil)
+	pager := NewPager(NewReaderFromText("testHorizontalCropping", contents))
 	pager.ShowLineNumbers = false
 
 	pager.screen = twin.NewFakeScreen(1+lastIndex-firstIndex, 99)
@@ -73,6 +73,7 @@ func TestSearchHighlight(t *testing.T) {
 	pager := Pager{
 		screen:        twin.NewFakeScreen(100, 10),
 		searchPattern: regexp.MustCompile("\""),
+		reader:        NewReaderFromText("test", line.raw),
 	}
 
 	rendered, overflow := pager.renderLine(&line, 1, pager.scrollPosition.internalDontTouch)
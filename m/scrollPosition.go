@@ -94,7 +94,8 @@ func NewScrollPositionFromLineNumberOneBased(lineNumberOneBased int, source stri
 
 // Move towards the top until deltaScreenLines is not negative any more
 func (si *scrollPositionInternal) handleNegativeDeltaScreenLines(pager *Pager) {
-	for si.lineNumberOneBased > 1 && si.deltaScreenLines < 0 {
+	topLineNumberOneBased := pager.firstScrollingLineOneBased()
+	for si.lineNumberOneBased > topLineNumberOneBased && si.deltaScreenLines < 0 {
 		// Render the previous line
 		previousLine := pager.reader.GetLine(si.lineNumberOneBased - 1)
 		previousSubLines, _ := pager.renderLine(previousLine, 0, *si)
@@ -105,9 +106,9 @@ func (si *scrollPositionInternal) handleNegativeDeltaScreenLines(pager *Pager) {
 		si.deltaScreenLines += len(previousSubLines)
 	}
 
-	if si.lineNumberOneBased <= 1 && si.deltaScreenLines <= 0 {
+	if si.lineNumberOneBased <= topLineNumberOneBased && si.deltaScreenLines <= 0 {
 		// Don't go above the top line
-		si.lineNumberOneBased = 1
+		si.lineNumberOneBased = topLineNumberOneBased
 		si.deltaScreenLines = 0
 	}
 }
@@ -380,6 +381,7 @@ func numberPrefixLength(pager *Pager, scrollPosition scrollPositionInternal) int
 	if maxVisibleLineNumber > maxPossibleLineNumber {
 		maxVisibleLineNumber = maxPossibleLineNumber
 	}
+	maxVisibleLineNumber = pager.reader.displayLineNumber(maxVisibleLineNumber)
 
 	// Count the length of the last line number
 	numberPrefixLength := len(formatNumber(uint(maxVisibleLineNumber))) + 1
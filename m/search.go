@@ -114,6 +114,7 @@ func (p *Pager) scrollToNextSearchHit() {
 		p.mode = _NotFound
 		return
 	}
+	p.pushJump()
 	p.scrollPosition = *firstHitPosition
 
 	// Don't let any search hit scroll out of sight
@@ -132,6 +133,7 @@ func (p *Pager) scrollToPreviousSearchHit() {
 	}
 
 	var firstSearchPosition scrollPosition
+	restarted := false
 
 	switch p.mode {
 	case _Viewing:
@@ -139,9 +141,11 @@ func (p *Pager) scrollToPreviousSearchHit() {
 		firstSearchPosition = p.scrollPosition.PreviousLine(1)
 
 	case _NotFound:
-		// Restart searching from the bottom
+		// Restart searching from the bottom, that's a jump in itself
 		p.mode = _Viewing
+		p.pushJump()
 		p.scrollToEnd()
+		restarted = true
 
 	default:
 		panic(fmt.Sprint("Unknown search mode when finding previous: ", p.mode))
@@ -152,6 +156,9 @@ func (p *Pager) scrollToPreviousSearchHit() {
 		p.mode = _NotFound
 		return
 	}
+	if !restarted {
+		p.pushJump()
+	}
 	p.scrollPosition = *firstHitPosition
 
 	// Don't let any search hit scroll out of sight
@@ -159,13 +166,26 @@ func (p *Pager) scrollToPreviousSearchHit() {
 }
 
 func (p *Pager) updateSearchPattern() {
-	p.searchPattern = toPattern(p.searchString)
+	p.searchPattern = p.toSearchPattern(p.searchString)
 
 	p.scrollToSearchHits()
 
 	// FIXME: If the user is typing, indicate to user if we didn't find anything
 }
 
+// Like toPattern, but searches for bytes rather than text when we're showing a
+// hex dump and the search string looks like hex bytes
+func (p *Pager) toSearchPattern(compileMe string) *regexp.Regexp {
+	if p.reader.isShowingHex() {
+		hexPattern := hexSearchPattern(compileMe)
+		if hexPattern != nil {
+			return hexPattern
+		}
+	}
+
+	return toPattern(compileMe)
+}
+
 // toPattern compiles a search string into a pattern.
 //
 // If the string contains only lower-case letter the pattern will be case insensitive.
@@ -0,0 +1,351 @@
+package m
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/walles/moar/twin"
+	"golang.org/x/text/width"
+)
+
+// Shown between table columns
+const _TableSeparator = " │ "
+
+// When we start showing a table, make the columns wide enough for this many
+// rows. Columns get wider as wider rows come into view.
+const _TableMeasureLineCount = 1000
+
+// Input shown as a table, with the first line as a header
+type _Table struct {
+	delimiter rune
+
+	// Widths of the columns we have seen so far
+	widths []int
+
+	// How many lines have been measured for the initial column widths
+	measuredLineCount int
+}
+
+// SetTableFormat decides how input of Readers created with these options is
+// shown as a table. Valid formats are "csv" and "tsv" for showing all input as
+// a table, "off" for never showing tables, or "" for showing .csv and .tsv
+// files as tables.
+func (options *ReaderOptions) SetTableFormat(format string) error {
+	options.tableDelimiter = 0
+	options.tablesDisabled = false
+
+	switch strings.ToLower(format) {
+	case "":
+	case "csv":
+		options.tableDelimiter = ','
+	case "tsv":
+		options.tableDelimiter = '\t'
+	case "off":
+		options.tablesDisabled = true
+	default:
+		return fmt.Errorf("Table format not supported, try csv, tsv or off: %s", format)
+	}
+
+	return nil
+}
+
+// Returns nil unless input with this name should be shown as a table.
+// Compressed files are recognized by their inner extension, like in
+// "data.csv.gz".
+func newTable(filename string, options ReaderOptions) *_Table {
+	if options.tablesDisabled {
+		return nil
+	}
+	if options.tableDelimiter != 0 {
+		return &_Table{delimiter: options.tableDelimiter}
+	}
+
+	extension := strings.ToLower(filepath.Ext(filename))
+	switch extension {
+	case ".gz", ".bz2", ".xz", ".zst", ".zstd", ".lz4":
+		extension = strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, filepath.Ext(filename))))
+	}
+
+	switch extension {
+	case ".csv":
+		return &_Table{delimiter: ','}
+	case ".tsv":
+		return &_Table{delimiter: '\t'}
+	}
+
+	return nil
+}
+
+// Split a line into fields. Fields can be quoted using double quotes, and
+// double quotes inside of quoted fields are written as two double quotes.
+//
+// Quoted fields spanning multiple lines aren't supported, an unterminated
+// quoted field ends at the end of the line.
+func splitTableRow(line string, delimiter rune) []string {
+	line = strings.TrimSuffix(line, "\r")
+
+	fields := []string{}
+	field := strings.Builder{}
+	quoted := false
+	fieldStarted := false
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+
+		if quoted {
+			if char != '"' {
+				field.WriteRune(char)
+			} else if i+1 < len(runes) && runes[i+1] == '"' {
+				// Escaped double quote
+				field.WriteRune('"')
+				i++
+			} else {
+				quoted = false
+			}
+			continue
+		}
+
+		switch {
+		case char == delimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+			fieldStarted = false
+		case char == '"' && !fieldStarted:
+			quoted = true
+			fieldStarted = true
+		default:
+			field.WriteRune(char)
+			fieldStarted = true
+		}
+	}
+
+	return append(fields, field.String())
+}
+
+func isNumber(field string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	return err == nil
+}
+
+// How many screen columns a string takes up in a terminal. CJK characters and
+// most emoji take two, combining marks none.
+func displayWidth(s string) int {
+	columns := 0
+	for _, char := range s {
+		switch {
+		case unicode.In(char, unicode.Mn, unicode.Me, unicode.Cf):
+			// Combining or invisible
+		case isWide(char):
+			columns += 2
+		default:
+			columns++
+		}
+	}
+	return columns
+}
+
+func isWide(char rune) bool {
+	kind := width.LookupRune(char).Kind()
+	return kind == width.EastAsianWide || kind == width.EastAsianFullwidth
+}
+
+// Make columns wide enough for these fields
+func (t *_Table) measure(fields []string) {
+	for i, field := range fields {
+		width := displayWidth(field)
+		if i >= len(t.widths) {
+			t.widths = append(t.widths, width)
+		} else if width > t.widths[i] {
+			t.widths[i] = width
+		}
+	}
+}
+
+// Measure the first lines of the input, so that columns don't change width as
+// much when scrolling down
+func (t *_Table) measureInitialLines(reader *Reader) {
+	lineCount := reader.GetLineCount()
+	if lineCount > _TableMeasureLineCount {
+		lineCount = _TableMeasureLineCount
+	}
+
+	for lineNumber := t.measuredLineCount + 1; lineNumber <= lineCount; lineNumber++ {
+		line := reader.GetLine(lineNumber)
+		if line == nil {
+			break
+		}
+		t.measure(splitTableRow(line.Plain(&lineNumber), t.delimiter))
+		t.measuredLineCount = lineNumber
+	}
+}
+
+// Format a table row with aligned columns. Numbers are right aligned.
+func (t *_Table) formatRow(fields []string, isHeader bool) string {
+	builder := strings.Builder{}
+	if isHeader {
+		builder.WriteString("\x1b[1;4m")
+	}
+
+	for i, field := range fields {
+		if i > 0 {
+			builder.WriteString(_TableSeparator)
+		}
+
+		padding := ""
+		if i < len(t.widths) {
+			padding = strings.Repeat(" ", t.widths[i]-displayWidth(field))
+		}
+
+		// Keep ANSI sequences in the input from messing up our formatting
+		field = strings.ReplaceAll(field, "\x1b", "?")
+
+		if !isHeader && isNumber(field) {
+			builder.WriteString(padding + field)
+		} else if i == len(fields)-1 {
+			// No trailing whitespace
+			builder.WriteString(field)
+		} else {
+			builder.WriteString(field + padding)
+		}
+	}
+
+	if isHeader {
+		builder.WriteString("\x1b[m")
+	}
+
+	return builder.String()
+}
+
+// Screen columns where each table column starts, in the same coordinates as
+// leftColumnZeroBased
+func (t *_Table) columnStarts() []int {
+	starts := []int{0}
+	for _, width := range t.widths {
+		starts = append(starts, starts[len(starts)-1]+width+displayWidth(_TableSeparator))
+	}
+
+	// The last entry is the end of the last column, not a start
+	return starts[:len(starts)-1]
+}
+
+// Where to scroll sideways to step one table column left (negative delta) or
+// right
+func (t *_Table) sideScrollTarget(leftColumnZeroBased int, delta int) int {
+	starts := t.columnStarts()
+	if delta > 0 {
+		for _, start := range starts {
+			if start > leftColumnZeroBased {
+				return start
+			}
+		}
+		return leftColumnZeroBased
+	}
+
+	for i := len(starts) - 1; i >= 0; i-- {
+		if starts[i] < leftColumnZeroBased {
+			return starts[i]
+		}
+	}
+	return 0
+}
+
+// The table if we're showing one, nil otherwise
+func (p *Pager) table() *_Table {
+	if p.reader == nil || p.reader.showingHex || p.reader.isShowingJson() {
+		return nil
+	}
+
+	return p.reader.table
+}
+
+// True if the first line of a table should stay on top when scrolling down
+func (p *Pager) hasFrozenHeader() bool {
+	if p.table() == nil {
+		return false
+	}
+
+	lineCount := p.reader.GetLineCount()
+	if !p.isShowingTableHeader() {
+		// Filtered out, but still shown above the rows that are left
+		return lineCount > 0
+	}
+	return lineCount > 1
+}
+
+// False if the table header has been filtered out
+func (p *Pager) isShowingTableHeader() bool {
+	return p.reader.unfilteredLineNumber(1) == 1
+}
+
+// The first line that scrolls, lines above this one always stay on top
+func (p *Pager) firstScrollingLineOneBased() int {
+	if p.hasFrozenHeader() && p.isShowingTableHeader() {
+		return 2
+	}
+	return 1
+}
+
+// Turn a line into an aligned table row, if we're showing a table
+func (p *Pager) tableRow(line *Line, lineNumber int) *Line {
+	table := p.table()
+	if table == nil {
+		return line
+	}
+
+	fields := splitTableRow(line.Plain(&lineNumber), table.delimiter)
+	table.measure(fields)
+
+	row := NewLine(table.formatRow(fields, p.reader.unfilteredLineNumber(lineNumber) == 1))
+	return &row
+}
+
+// Make columns wide enough for both the header and these lines
+func (p *Pager) measureTableRows(lines []*Line, firstLineOneBased int) {
+	table := p.table()
+	if table == nil {
+		return
+	}
+
+	table.measureInitialLines(p.reader)
+	for i, line := range lines {
+		lineNumber := firstLineOneBased + i
+		table.measure(splitTableRow(line.Plain(&lineNumber), table.delimiter))
+	}
+}
+
+// Render the table header, to be shown above the scrolling lines
+func (p *Pager) renderTableHeader() []twin.Cell {
+	if !p.isShowingTableHeader() {
+		return p.renderFilteredOutTableHeader()
+	}
+
+	header := p.reader.GetLine(1)
+	if header == nil {
+		return nil
+	}
+
+	p.measureTableRows([]*Line{header}, 1)
+	rendered, _ := p.renderLine(header, 1, p.scrollPosition.internalDontTouch)
+	return rendered[0].cells
+}
+
+// Filters don't hide the table header, but it has no line number of its own
+// in the filtered view, so render it from the unfiltered lines.
+func (p *Pager) renderFilteredOutTableHeader() []twin.Cell {
+	header := p.reader.unfilteredLine(1)
+	if header == nil {
+		return nil
+	}
+
+	table := p.table()
+	fields := splitTableRow(header.Plain(nil), table.delimiter)
+	table.measure(fields)
+	row := NewLine(table.formatRow(fields, true))
+
+	lineNumber := 1
+	cells, _ := p.decorateLine(&lineNumber, row.HighlightedTokens(p.linePrefix, nil, nil).Cells, p.scrollPosition.internalDontTouch)
+	return cells
+}
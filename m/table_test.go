@@ -0,0 +1,130 @@
+package m
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestSplitTableRow(t *testing.T) {
+	assert.DeepEqual(t, splitTableRow("a,b,c", ','), []string{"a", "b", "c"})
+	assert.DeepEqual(t, splitTableRow(`"a,b",c`, ','), []string{"a,b", "c"})
+	assert.DeepEqual(t, splitTableRow(`"say ""hi""",x`, ','), []string{`say "hi"`, "x"})
+	assert.DeepEqual(t, splitTableRow(",,", ','), []string{"", "", ""})
+	assert.DeepEqual(t, splitTableRow("a\tb,c\r", '\t'), []string{"a", "b,c"})
+
+	// Quotes inside of unquoted fields are just text
+	assert.DeepEqual(t, splitTableRow(`5" disk,x`, ','), []string{`5" disk`, "x"})
+
+	// Unterminated quotes end at the end of the line
+	assert.DeepEqual(t, splitTableRow(`a,"b,c`, ','), []string{"a", "b,c"})
+}
+
+func TestNewTable(t *testing.T) {
+	assert.Equal(t, newTable("data.csv", ReaderOptions{}).delimiter, ',')
+	assert.Equal(t, newTable("/x/data.TSV.gz", ReaderOptions{}).delimiter, '\t')
+	assert.Assert(t, newTable("data.txt", ReaderOptions{}) == nil)
+	assert.Assert(t, newTable("", ReaderOptions{}) == nil)
+
+	var options ReaderOptions
+	assert.NilError(t, options.SetTableFormat("tsv"))
+	assert.Equal(t, newTable("", options).delimiter, '\t')
+
+	assert.NilError(t, options.SetTableFormat("off"))
+	assert.Assert(t, newTable("data.csv", options) == nil)
+
+	assert.Assert(t, options.SetTableFormat("xml") != nil)
+}
+
+func TestDisplayWidth(t *testing.T) {
+	assert.Equal(t, displayWidth("abc"), 3)
+	assert.Equal(t, displayWidth("åäö"), 3)
+	assert.Equal(t, displayWidth("e\u0301"), 1)
+	assert.Equal(t, displayWidth("日本語"), 6)
+	assert.Equal(t, displayWidth("🎉"), 2)
+}
+
+// Wide characters should not push the next column out of line
+func TestTableWideCharacters(t *testing.T) {
+	table := newTable("table.csv", ReaderOptions{})
+	table.measure([]string{"日本", "1"})
+	table.measure([]string{"abc", "2"})
+
+	assert.Equal(t, table.formatRow([]string{"日本", "x"}, false), "日本"+_TableSeparator+"x")
+	assert.Equal(t, table.formatRow([]string{"abc", "y"}, false), "abc "+_TableSeparator+"y")
+}
+
+func tablePager(rowCount int) (*Pager, *twin.FakeScreen) {
+	lines := []string{"name,amount"}
+	for i := 1; i <= rowCount; i++ {
+		lines = append(lines, fmt.Sprintf("item %d,%d", i, i*100))
+	}
+	reader := NewReaderFromText("table.csv", strings.Join(lines, "\n"))
+	reader.table = newTable("table.csv", ReaderOptions{})
+
+	pager := NewPager(reader)
+	pager.ShowLineNumbers = false
+	screen := twin.NewFakeScreen(30, 6)
+	pager.screen = screen
+	return pager, screen
+}
+
+func TestTableFrozenHeader(t *testing.T) {
+	pager, screen := tablePager(20)
+
+	pager.redraw("")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(0))), "name    │ amount")
+	assert.Equal(t, screen.GetRow(0)[0].Style, twin.StyleDefault.WithAttr(twin.AttrBold).WithAttr(twin.AttrUnderline))
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(1))), "item 1  │    100")
+
+	// The header stays when scrolling down
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(11, "TestTableFrozenHeader")
+	pager.redraw("")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(0))), "name    │ amount")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(1))), "item 10 │   1000")
+
+	// Scrolling to the top doesn't show the header twice
+	pager.scrollPosition = pager.scrollPosition.PreviousLine(100)
+	pager.redraw("")
+	assert.Equal(t, pager.lineNumberOneBased(), 2)
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(1))), "item 1  │    100")
+
+	// Scrolled to the end, the last row should be visible above the status bar
+	pager.scrollToEnd()
+	pager.redraw("")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(4))), "item 20 │   2000")
+}
+
+func TestTableSideScrolling(t *testing.T) {
+	pager, _ := tablePager(20)
+	pager.redraw("")
+
+	// To where "amount" starts, after "item 20" and the separator
+	pager.onKey(twin.KeyRight)
+	assert.Equal(t, pager.leftColumnZeroBased, 10)
+
+	// No more columns to the right
+	pager.onKey(twin.KeyRight)
+	assert.Equal(t, pager.leftColumnZeroBased, 10)
+
+	pager.onKey(twin.KeyLeft)
+	assert.Equal(t, pager.leftColumnZeroBased, 0)
+}
+
+func TestTableHeaderWhenFiltering(t *testing.T) {
+	pager, screen := tablePager(20)
+	pager.redraw("")
+
+	typeFilter(pager, "item 1[24]")
+	pager.redraw("")
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(0))), "name    │ amount")
+	assert.Equal(t, screen.GetRow(0)[0].Style, twin.StyleDefault.WithAttr(twin.AttrBold).WithAttr(twin.AttrUnderline))
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(1))), "item 12 │   1200")
+
+	// Highlighted as a match, not as a header
+	assert.Equal(t, screen.GetRow(1)[0].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+	assert.Equal(t, strings.TrimSpace(rowToString(screen.GetRow(2))), "item 14 │   1400")
+}
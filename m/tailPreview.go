@@ -0,0 +1,199 @@
+package m
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// How much of the end of a file to read when the user wants to see the end of
+// the file before we're done reading all of it
+const _TailPreviewSize int64 = 1024 * 1024
+
+// Read the last lines of a file, at most maxBytes bytes of them. Any partial
+// line at the start of the read block is dropped.
+//
+// Returns the lines, how many bytes those lines cover and the size of the file.
+func readTail(filename string, maxBytes int64) ([]string, int64, int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Warn("Error closing file after reading its tail: ", err)
+		}
+	}()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	fileSize := stat.Size()
+
+	start := fileSize - maxBytes
+	if start < 0 {
+		start = 0
+	}
+
+	buffer := make([]byte, fileSize-start)
+	readCount, err := file.ReadAt(buffer, start)
+	if err != nil && err != io.EOF {
+		return nil, 0, 0, err
+	}
+	buffer = buffer[:readCount]
+
+	if start > 0 {
+		// We most likely started in the middle of a line, skip to the next one
+		firstNewline := bytes.IndexByte(buffer, '\n')
+		if firstNewline < 0 {
+			// One huge line, nothing useful to show
+			return []string{}, 0, fileSize, nil
+		}
+		buffer = buffer[firstNewline+1:]
+	}
+	tailBytes := int64(len(buffer))
+
+	text := strings.TrimSuffix(string(buffer), "\n")
+	if len(text) == 0 {
+		return []string{}, tailBytes, fileSize, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines, tailBytes, fileSize, nil
+}
+
+// Create a Reader with the last lines of the source Reader's file, for showing
+// while the source Reader is still busy reading the rest of the file.
+//
+// Since we don't know how many lines there are before the ones we show, line
+// numbers are estimated from the average line length so far.
+//
+// Returns nil if no preview can be made.
+func newTailPreviewReader(source *Reader) *Reader {
+	source.Lock()
+	if source.seekableFilename == nil {
+		source.Unlock()
+		return nil
+	}
+	filename := *source.seekableFilename
+	name := source.name
+	linesSoFar := source.lineCountUnlocked()
+	bytesSoFar := source.bytesRead
+	if source.fileLines != nil {
+		bytesSoFar = source.fileLines.end
+	}
+	source.Unlock()
+
+	tailLines, tailBytes, fileSize, err := readTail(filename, _TailPreviewSize)
+	if err != nil {
+		log.Debugf("Reading the end of %s failed: %s", filename, err)
+		return nil
+	}
+	if len(tailLines) == 0 {
+		return nil
+	}
+
+	bytesPerLine := float64(tailBytes) / float64(len(tailLines))
+	if linesSoFar > 0 && bytesSoFar > 0 {
+		bytesPerLine = float64(bytesSoFar) / float64(linesSoFar)
+	}
+
+	lineNumberOffset := int(math.Round(float64(fileSize-tailBytes) / bytesPerLine))
+	if lineNumberOffset < linesSoFar {
+		// There are at least as many lines before the tail as we have already
+		// read
+		lineNumberOffset = linesSoFar
+	}
+
+	preview := newReader()
+	preview.name = name
+	preview.lineNumberOffset = lineNumberOffset
+	preview.lineNumbersAreEstimates = true
+	for _, tailLine := range tailLines {
+		line := NewLine(tailLine)
+		preview.lines = append(preview.lines, &line)
+	}
+	preview.highlightingDone.Store(true) // No highlighting to do = nothing left = Done!
+	preview.done.Store(true)
+
+	return preview
+}
+
+// Show the end of the current file, even if we haven't read all of it yet
+func (p *Pager) startTailPreview() {
+	if p.tailPreviewSource != nil || p.isShowingHelp {
+		// Already previewing, or previewing isn't applicable
+		return
+	}
+
+	if p.reader.done.Load() {
+		// All lines already available, no need to preview anything
+		return
+	}
+
+	preview := newTailPreviewReader(p.reader)
+	if preview == nil {
+		return
+	}
+
+	log.Debugf("Showing the end of the input while still reading, line numbers are offset by ~%d",
+		preview.lineNumberOffset)
+	p.tailPreviewSource = p.reader
+	p.reader = preview
+}
+
+// Stop showing a tail preview and go back to the real Reader.
+//
+// If the real Reader is done, the position is kept by counting lines from the
+// end. Otherwise we don't know where we are, and the caller is responsible
+// for setting a new scroll position.
+func (p *Pager) endTailPreview() {
+	if p.tailPreviewSource == nil {
+		return
+	}
+
+	// Both the preview and the real Reader end with the same lines
+	linesFromEnd := p.reader.GetLineCount() - p.lineNumberOneBased()
+
+	p.reader = p.tailPreviewSource
+	p.tailPreviewSource = nil
+
+	if !p.reader.done.Load() {
+		p.scrollPosition = newScrollPosition("Pager scroll position")
+		return
+	}
+
+	newLineNumber := p.reader.GetLineCount() - linesFromEnd
+	if newLineNumber < 1 {
+		newLineNumber = 1
+	}
+	p.scrollPosition = NewScrollPositionFromLineNumberOneBased(newLineNumber, "endTailPreview")
+}
+
+// Go back to the real Reader once it's done reading
+func (p *Pager) maybeEndTailPreview() {
+	if p.tailPreviewSource == nil {
+		return
+	}
+
+	if p.isShowingHelp {
+		// p.reader is the help text, not our preview
+		return
+	}
+
+	if !p.tailPreviewSource.done.Load() {
+		return
+	}
+
+	p.endTailPreview()
+}
@@ -0,0 +1,134 @@
+package m
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+// Create a file with lines "line 1" to "line <lineCount>"
+func createNumberedLinesFile(t *testing.T, lineCount int) string {
+	builder := strings.Builder{}
+	for i := 1; i <= lineCount; i++ {
+		builder.WriteString("line ")
+		builder.WriteString(strconv.Itoa(i))
+		builder.WriteString("\n")
+	}
+
+	filename := filepath.Join(t.TempDir(), "numbered.txt")
+	err := os.WriteFile(filename, []byte(builder.String()), 0o600)
+	assert.NilError(t, err)
+	return filename
+}
+
+func TestReadTail(t *testing.T) {
+	filename := createNumberedLinesFile(t, 100)
+
+	// Just enough for the last two lines, "line 99\n" is eight bytes
+	lines, tailBytes, fileSize, err := readTail(filename, 8+9)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lines, []string{"line 100"})
+	assert.Equal(t, tailBytes, int64(9))
+
+	stat, err := os.Stat(filename)
+	assert.NilError(t, err)
+	assert.Equal(t, fileSize, stat.Size())
+
+	// One more byte, now "line 99" isn't partial any more
+	lines, tailBytes, _, err = readTail(filename, 8+9+1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lines, []string{"line 99", "line 100"})
+	assert.Equal(t, tailBytes, int64(8+9))
+}
+
+func TestReadTailWholeFile(t *testing.T) {
+	filename := createNumberedLinesFile(t, 3)
+
+	lines, _, _, err := readTail(filename, _TailPreviewSize)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lines, []string{"line 1", "line 2", "line 3"})
+}
+
+// Make a Reader that has read the first lines of the file, and then just hangs
+func newStuckReader(filename string, linesRead int) *Reader {
+	reader := newReader()
+	reader.name = &filename
+	reader.seekableFilename = &filename
+	for i := 1; i <= linesRead; i++ {
+		line := NewLine("line " + strconv.Itoa(i))
+		reader.lines = append(reader.lines, &line)
+		reader.bytesRead += int64(len(line.raw)) + 1
+	}
+	return reader
+}
+
+func TestTailPreview(t *testing.T) {
+	filename := createNumberedLinesFile(t, 5000)
+	stuck := newStuckReader(filename, 10)
+
+	pager := NewPager(stuck)
+	pager.screen = twin.NewFakeScreen(20, 5)
+
+	pager.onRune('G')
+	assert.Assert(t, pager.tailPreviewSource == stuck)
+	assert.Equal(t, pager.reader.GetLine(pager.reader.GetLineCount()).Plain(nil), "line 5000")
+
+	// The estimated number of the last line should be in the right ballpark
+	estimatedLastLineNumber := pager.reader.displayLineNumber(pager.reader.GetLineCount())
+	assert.Assert(t, estimatedLastLineNumber > 4000, estimatedLastLineNumber)
+	assert.Assert(t, estimatedLastLineNumber < 6000, estimatedLastLineNumber)
+
+	lines, _ := pager.reader.GetLines(pager.reader.GetLineCount(), 1)
+	assert.Assert(t, strings.Contains(lines.statusText, "line numbers are estimates"), lines.statusText)
+
+	// Back to the top should get us back to the real Reader
+	pager.onRune('<')
+	assert.Assert(t, pager.tailPreviewSource == nil)
+	assert.Assert(t, pager.reader == stuck)
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+}
+
+func TestTailPreviewEndsWhenDone(t *testing.T) {
+	filename := createNumberedLinesFile(t, 5000)
+	stuck := newStuckReader(filename, 10)
+
+	pager := NewPager(stuck)
+	pager.ShowLineNumbers = false
+	pager.screen = twin.NewFakeScreen(20, 5)
+
+	pager.onRune('G')
+	assert.Assert(t, pager.tailPreviewSource == stuck)
+
+	// Pretend the real Reader finished reading the rest of the file
+	for i := 11; i <= 5000; i++ {
+		line := NewLine("line " + strconv.Itoa(i))
+		stuck.lines = append(stuck.lines, &line)
+	}
+	stuck.done.Store(true)
+
+	pager.maybeEndTailPreview()
+	assert.Assert(t, pager.tailPreviewSource == nil)
+	assert.Assert(t, pager.reader == stuck)
+
+	// We should still be showing the end of the file
+	assert.Equal(t, pager.isScrolledToEnd(), true)
+	assert.Equal(t, pager.lineNumberOneBased(), 5000-3)
+}
+
+func TestNoTailPreviewForStreams(t *testing.T) {
+	reader := newReader()
+	line := NewLine("streaming")
+	reader.lines = append(reader.lines, &line)
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(20, 5)
+
+	pager.onRune('G')
+	assert.Assert(t, pager.tailPreviewSource == nil)
+	assert.Assert(t, pager.reader == reader)
+}
@@ -0,0 +1,177 @@
+package m
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// How often to check whether a command run has finished
+const _WatchPollInterval = 50 * time.Millisecond
+
+// Watch re-runs the command of this Reader periodically, like watch(1) does.
+// Each run replaces the contents of this Reader, and cells that changed since
+// the previous run are highlighted.
+//
+// The interval is counted from when one run is done until the next one starts.
+// Re-running stops when the pager is done with this Reader.
+//
+// Only works on Readers created by NewReaderFromCommand(), does nothing for
+// other Readers.
+func (reader *Reader) Watch(interval time.Duration) {
+	reader.Lock()
+	command := reader.command
+	options := reader.options
+	if command == nil {
+		reader.Unlock()
+		log.Debug("Not watching Reader without a command")
+		return
+	}
+	reader.watchInterval = interval
+	reader.Unlock()
+
+	go func() {
+		// Let the initial run finish first
+		waitForRun(reader)
+
+		for {
+			time.Sleep(interval)
+			if reader.released.Load() {
+				log.Debugf("Done watching %v", command)
+				return
+			}
+			if reader.watchPaused.Load() {
+				continue
+			}
+
+			run, err := NewReaderFromCommandWithOptions(command, options)
+			if err != nil {
+				log.Warnf("Re-running %v failed: %s", command, err)
+				continue
+			}
+			waitForRun(run)
+
+			// We only want the lines, the run itself is done with
+			run.release()
+			if reader.watchPaused.Load() || reader.released.Load() {
+				// Paused or released while running, keep showing what we have
+				continue
+			}
+
+			run.Lock()
+			lines := run.lines
+			exitStatus := run.exitStatus
+			runErr := run.err
+			run.Unlock()
+
+			reader.Lock()
+			reader.watchPreviousLines = reader.lines
+			reader.exitStatus = exitStatus
+			reader.err = runErr
+			reader.Unlock()
+
+			reader.setLines(lines)
+		}
+	}()
+}
+
+// Wait until some command Reader has read all output and its command has
+// exited
+func waitForRun(run *Reader) {
+	for {
+		run.Lock()
+		exited := run.exitStatus != nil || run.err != nil
+		run.Unlock()
+
+		if exited && run.done.Load() {
+			return
+		}
+
+		time.Sleep(_WatchPollInterval)
+	}
+}
+
+// Pause or resume re-running the command
+func (p *Pager) toggleWatchPaused() {
+	p.reader.Lock()
+	watching := p.reader.watchInterval > 0
+	p.reader.Unlock()
+	if !watching {
+		return
+	}
+
+	p.reader.watchPaused.Store(!p.reader.watchPaused.Load())
+}
+
+// Status bar text telling the user whether we're re-running the command
+func (r *Reader) watchStatusUnlocked() string {
+	if r.watchInterval <= 0 {
+		return ""
+	}
+
+	if r.watchPaused.Load() {
+		return "  paused, press 'P' to resume"
+	}
+
+	return "  every " + r.watchInterval.String()
+}
+
+// Get the input line shown on some line, and the same input line from the
+// previous command run, for figuring out what changed.
+//
+// The diffing return value is false if we haven't re-run the command yet, or
+// if the line doesn't show any single input line.
+func (r *Reader) watchLines(lineNumberOneBased int) (current *Line, previous *Line, diffing bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.watchPreviousLines == nil {
+		return nil, nil, false
+	}
+
+	inputLineNumber := r.inputLineNumberUnlocked(lineNumberOneBased)
+	if inputLineNumber < 1 || inputLineNumber > len(r.lines) {
+		return nil, nil, false
+	}
+	current = r.lines[inputLineNumber-1]
+
+	if inputLineNumber > len(r.watchPreviousLines) {
+		return current, nil, true
+	}
+
+	return current, r.watchPreviousLines[inputLineNumber-1], true
+}
+
+// Highlight cells that changed since the previous command run, like "watch -d"
+// does
+func (p *Pager) markWatchChanges(cells []twin.Cell, line *Line, lineNumber int) {
+	current, previous, diffing := p.reader.watchLines(lineNumber)
+	if !diffing {
+		return
+	}
+
+	if line != current {
+		// Shown as JSON, log lines or a table row, so the cells don't match
+		// up with the input. Mark the whole line if its input line changed.
+		if previous != nil && previous.Plain(nil) == current.Plain(nil) {
+			return
+		}
+		for i := range cells {
+			cells[i].Style = cells[i].Style.WithAttr(twin.AttrReverse)
+		}
+		return
+	}
+
+	var previousCells []twin.Cell
+	if previous != nil {
+		previousCells = previous.HighlightedTokens(p.linePrefix, nil, &lineNumber).Cells
+	}
+
+	for i := range cells {
+		if i < len(previousCells) && previousCells[i].Rune == cells[i].Rune {
+			continue
+		}
+		cells[i].Style = cells[i].Style.WithAttr(twin.AttrReverse)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+// +build !windows
+
+package m
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+// Wait until the watched Reader has been updated with a new command run
+func waitForWatchUpdate(t *testing.T, reader *Reader) {
+	waitFor(t, "Watched command was never re-run", func() bool {
+		reader.Lock()
+		defer reader.Unlock()
+		return reader.watchPreviousLines != nil
+	})
+}
+
+func TestWatch(t *testing.T) {
+	filename := t.TempDir() + "/watched.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("pod-1 Running\npod-2 Pending\n"), 0o600))
+
+	reader, err := NewReaderFromCommand([]string{"cat", filename})
+	assert.NilError(t, err)
+	waitForExitStatus(t, reader)
+	assert.DeepEqual(t, readLines(t, reader), []string{"pod-1 Running", "pod-2 Pending"})
+
+	pager := NewPager(reader)
+	screen := twin.NewFakeScreen(40, 5)
+	pager.screen = screen
+	pager.ShowLineNumbers = false
+
+	assert.NilError(t, os.WriteFile(filename, []byte("pod-1 Running\npod-2 Running\npod-3 Pending\n"), 0o600))
+	// Long enough for us to pause before the next run
+	reader.Watch(200 * time.Millisecond)
+	waitForWatchUpdate(t, reader)
+	pager.onRune('P') // Pause so that we can look at the result
+	assert.Assert(t, reader.watchPaused.Load())
+	assert.DeepEqual(t, readLines(t, reader), []string{"pod-1 Running", "pod-2 Running", "pod-3 Pending"})
+
+	pager.redraw("")
+
+	// Unchanged line
+	assert.Equal(t, screen.GetRow(0)[6].Style, twin.StyleDefault)
+
+	// "Pending" changed into "Running", but the "n" at index 10 is the same
+	row := screen.GetRow(1)
+	assert.Equal(t, row[6].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+	assert.Equal(t, row[10].Style, twin.StyleDefault)
+
+	// New line
+	assert.Equal(t, screen.GetRow(2)[0].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+
+	pager.onRune('P')
+	assert.Assert(t, !reader.watchPaused.Load())
+}
+
+func TestWatchStopsWhenReleased(t *testing.T) {
+	filename := t.TempDir() + "/watched.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("a\n"), 0o600))
+
+	reader, err := NewReaderFromCommand([]string{"cat", filename})
+	assert.NilError(t, err)
+	waitForExitStatus(t, reader)
+
+	reader.Watch(10 * time.Millisecond)
+	reader.release()
+	time.Sleep(200 * time.Millisecond)
+
+	reader.Lock()
+	defer reader.Unlock()
+	assert.Assert(t, reader.watchPreviousLines == nil)
+}
+
+func TestWatchNeedsCommand(t *testing.T) {
+	reader := NewReaderFromText("text", "a")
+	reader.Watch(time.Second)
+	assert.Equal(t, reader.watchInterval, time.Duration(0))
+}
@@ -0,0 +1,142 @@
+package m
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// NewWritableReader creates an empty Reader for programs that produce their
+// own lines. Add lines to it using AppendLines() or ReplaceLines(), and call
+// Close() or CloseWithError() when there won't be any more.
+//
+// A Pager showing this Reader picks up changes as they are made, and follows
+// new lines as long as the user is on the last line.
+//
+// The name can be an empty string (""). If non-empty, the name will be
+// displayed by the pager in the bottom left corner.
+//
+// The methods for changing the Reader contents are safe to call from any
+// goroutine.
+func NewWritableReader(name string) *Reader {
+	reader := newReader()
+	reader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+	reader.writable = true
+	if len(name) > 0 {
+		reader.name = &name
+	}
+
+	return reader
+}
+
+// Other Readers get their lines from their input, and would break if somebody
+// else changed those
+func (reader *Reader) checkWritable(operation string) bool {
+	if !reader.writable {
+		log.Warn("Can only ", operation, " Readers created by NewWritableReader()")
+		return false
+	}
+	return true
+}
+
+// Turn strings into Lines
+func linesFromStrings(lineStrings []string) []*Line {
+	lines := make([]*Line, 0, len(lineStrings))
+	for _, lineString := range lineStrings {
+		line := NewLine(lineString)
+		lines = append(lines, &line)
+	}
+	return lines
+}
+
+// AppendLines adds lines to the end of a Reader created by NewWritableReader().
+//
+// Each string is one line, which may contain ANSI formatting, but should not
+// contain any newlines.
+func (reader *Reader) AppendLines(lines ...string) {
+	if !reader.checkWritable("append lines to") {
+		return
+	}
+	if reader.done.Load() {
+		log.Warn("Not appending lines to a closed Reader")
+		return
+	}
+
+	newLines := linesFromStrings(lines)
+
+	reader.Lock()
+	reader.lines = append(reader.lines, newLines...)
+	reader.Unlock()
+
+	reader.signalMoreLinesAdded()
+}
+
+// ReplaceLines replaces all lines of a Reader created by NewWritableReader().
+//
+// Each string is one line, which may contain ANSI formatting, but should not
+// contain any newlines.
+func (reader *Reader) ReplaceLines(lines ...string) {
+	if !reader.checkWritable("replace lines of") {
+		return
+	}
+	if reader.done.Load() {
+		log.Warn("Not replacing lines of a closed Reader")
+		return
+	}
+
+	newLines := linesFromStrings(lines)
+
+	reader.Lock()
+	reader.lines = newLines
+	if reader.filter != nil {
+		// All new lines, filter them from the start
+		reader.updateFilterUnlocked()
+	}
+	reader.Unlock()
+
+	reader.signalMoreLinesAdded()
+}
+
+// Close tells the pager that no more lines are coming to a Reader created by
+// NewWritableReader().
+func (reader *Reader) Close() {
+	if !reader.checkWritable("close") {
+		return
+	}
+	if reader.done.Swap(true) {
+		// Already closed
+		return
+	}
+
+	select {
+	case reader.maybeDone <- true:
+	default:
+	}
+
+	// Make the pager redraw the status bar
+	reader.signalMoreLinesAdded()
+}
+
+// CloseWithError is like Close(), but also shows an error in the pager's
+// status bar. The user can press 'E' for the full error message.
+func (reader *Reader) CloseWithError(err error) {
+	if !reader.checkWritable("close") {
+		return
+	}
+
+	reader.Lock()
+	if reader.err == nil {
+		// Don't overwrite any error we already have
+		reader.err = err
+	}
+	reader.Unlock()
+
+	reader.Close()
+}
+
+func (reader *Reader) signalMoreLinesAdded() {
+	// Non-blocking, if the pager already has a notification pending it will
+	// pick up these lines as well
+	select {
+	case reader.moreLinesAdded <- true:
+	default:
+	}
+}
@@ -0,0 +1,70 @@
+package m
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWritableReaderAppend(t *testing.T) {
+	reader := NewWritableReader("written")
+	assert.Equal(t, reader.GetLineCount(), 0)
+	assert.Equal(t, reader.done.Load(), false)
+
+	reader.AppendLines("one", "\x1b[1mtwo\x1b[m")
+	reader.AppendLines("three")
+
+	// The pager should be told about the new lines
+	assert.Equal(t, <-reader.moreLinesAdded, true)
+
+	assert.Equal(t, reader.GetLineCount(), 3)
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "two")
+	assert.Equal(t, reader.GetLine(3).Plain(nil), "three")
+
+	reader.Close()
+	assert.Equal(t, reader.done.Load(), true)
+	assert.Equal(t, <-reader.maybeDone, true)
+
+	// Closed Readers don't change any more
+	reader.AppendLines("four")
+	assert.Equal(t, reader.GetLineCount(), 3)
+}
+
+func TestWritableReaderReplace(t *testing.T) {
+	reader := NewWritableReader("")
+	reader.AppendLines("old", "lines", "here")
+	reader.ReplaceLines("new")
+	reader.Close()
+
+	assert.DeepEqual(t, readLines(t, reader), []string{"new"})
+}
+
+func TestWritableReaderError(t *testing.T) {
+	reader := NewWritableReader("broken")
+	reader.AppendLines("partial")
+	reader.CloseWithError(errors.New("connection lost"))
+
+	assert.Equal(t, reader.done.Load(), true)
+	summary, _ := reader.problems()
+	assert.Equal(t, summary, "connection lost")
+
+	// The lines we got are still there
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "partial")
+}
+
+func TestWritableReaderOnly(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	defer pipeWriter.Close()
+
+	reader := NewReaderFromStream("", pipeReader)
+	reader.AppendLines("not from the stream")
+	reader.CloseWithError(errors.New("not from the stream either"))
+
+	// Still reading the stream
+	assert.Equal(t, reader.done.Load(), false)
+	assert.Equal(t, reader.GetLineCount(), 0)
+	summary, _ := reader.problems()
+	assert.Equal(t, summary, "")
+}
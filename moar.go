@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -51,14 +52,19 @@ func printUsage(output io.Writer, flagSet *flag.FlagSet, printCommandline bool)
 	}
 
 	_, _ = fmt.Fprintln(output, "Usage:")
-	_, _ = fmt.Fprintln(output, "  moar [options] <file>")
+	_, _ = fmt.Fprintln(output, "  moar [options] <file> ...")
 	_, _ = fmt.Fprintln(output, "  ... | moar")
 	_, _ = fmt.Fprintln(output, "  moar < file")
+	_, _ = fmt.Fprintln(output, "  moar [options] -- <command> [arguments] ...")
 	_, _ = fmt.Fprintln(output)
 	_, _ = fmt.Fprintln(output, "Shows file contents. Compressed files will be transparently decompressed.")
 	_, _ = fmt.Fprintln(output, "Input is expected to be (possibly compressed) UTF-8 encoded text. Invalid /")
 	_, _ = fmt.Fprintln(output, "non-printable characters are by default rendered as '?'.")
 	_, _ = fmt.Fprintln(output)
+	_, _ = fmt.Fprintln(output, "Commands after '--' are run in a pseudo terminal, so they keep their colors.")
+	_, _ = fmt.Fprintln(output)
+	_, _ = fmt.Fprintln(output, "Directories are shown as listings, press RETURN to open the selected entry.")
+	_, _ = fmt.Fprintln(output)
 	_, _ = fmt.Fprintln(output, "More information + source code:")
 	_, _ = fmt.Fprintln(output, "  <https://github.com/walles/moar#readme>")
 	_, _ = fmt.Fprintln(output)
@@ -74,6 +80,8 @@ func printUsage(output io.Writer, flagSet *flag.FlagSet, printCommandline bool)
 	printUsageEnvVar(output, "LESS_TERMCAP_md", "man page bold style")
 	printUsageEnvVar(output, "LESS_TERMCAP_us", "man page underline style")
 	printUsageEnvVar(output, "LESS_TERMCAP_so", "search hits and footer style")
+	printUsageEnvVar(output, "LESSOPEN", "input preprocessor")
+	printUsageEnvVar(output, "LESSCLOSE", "input postprocessor")
 
 	absMoarPath, err := absLookPath(os.Args[0])
 	if err == nil {
@@ -241,6 +249,26 @@ func parseShiftAmount(shiftAmount string) (uint, error) {
 	return uint(value), nil
 }
 
+// Parse durations like "2s" or "500ms". Plain numbers are seconds, just like
+// for watch(1).
+func parseWatchInterval(interval string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(interval, 64)
+	if err == nil {
+		interval = fmt.Sprintf("%gs", seconds)
+	}
+
+	value, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, err
+	}
+
+	if value <= 0 {
+		return 0, fmt.Errorf("Watch interval must be positive, was %s", interval)
+	}
+
+	return value, nil
+}
+
 func parseMouseMode(mouseMode string) (twin.MouseMode, error) {
 	switch mouseMode {
 	case "auto":
@@ -254,24 +282,50 @@ func parseMouseMode(mouseMode string) (twin.MouseMode, error) {
 	return twin.MouseModeAuto, fmt.Errorf("Valid modes are auto, mark and scroll")
 }
 
-func pumpToStdout(inputFilename *string) error {
-	if inputFilename != nil {
-		// If we get both redirected stdin and an input filename, we must prefer
-		// to copy the file, because that's how less works. That's why we go for
-		// the filename first.
-		inputFile, err := os.Open(*inputFilename)
-		if err != nil {
-			return fmt.Errorf("Failed to open %s: %w", *inputFilename, err)
-		}
+// Run a command with its output going straight to our stdout, then exit with
+// the command's exit code
+func runCommandToStdout(command []string) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
-		_, err = io.Copy(os.Stdout, inputFile)
-		if err != nil {
-			return fmt.Errorf("Failed to copy %s to stdout: %w", *inputFilename, err)
+	err := cmd.Run()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		os.Exit(exitError.ExitCode())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func pumpToStdout(inputFilenames []string) error {
+	if len(inputFilenames) > 0 {
+		// If we get both redirected stdin and input filenames, we must prefer
+		// to copy the files, because that's how less works. That's why we go
+		// for the filenames first.
+		for _, inputFilename := range inputFilenames {
+			inputFile, err := os.Open(inputFilename)
+			if err != nil {
+				return fmt.Errorf("Failed to open %s: %w", inputFilename, err)
+			}
+
+			_, err = io.Copy(os.Stdout, inputFile)
+			closeErr := inputFile.Close()
+			if err != nil {
+				return fmt.Errorf("Failed to copy %s to stdout: %w", inputFilename, err)
+			}
+			if closeErr != nil {
+				return fmt.Errorf("Failed to close %s: %w", inputFilename, closeErr)
+			}
 		}
 		return nil
 	}
 
-	// Must be done after trying to pump the input filename to stdout to be
+	// Must be done after trying to pump the input filenames to stdout to be
 	// compatible with less, see above.
 	_, err := io.Copy(os.Stdout, os.Stdin)
 	if err != nil {
@@ -288,6 +342,12 @@ func tryOpen(filename string) error {
 		return err
 	}
 
+	stat, err := tryMe.Stat()
+	if err == nil && stat.IsDir() {
+		// Directories are shown as listings
+		return tryMe.Close()
+	}
+
 	// Try reading a byte
 	buffer := make([]byte, 1)
 	_, err = tryMe.Read(buffer)
@@ -306,12 +366,17 @@ func tryOpen(filename string) error {
 	return err
 }
 
-// Parses an argument like "+123" anywhere on the command line into a one-based
-// line number, and returns the remaining args.
+// Parses an argument like "+123" anywhere on the command line before any "--"
+// into a one-based line number, and returns the remaining args.
 //
 // Returns 0 on no target line number specified.
 func getTargetLineNumberOneBased(args []string) (int, []string) {
 	for i, arg := range args {
+		if arg == "--" {
+			// Anything after this belongs to the command we should run
+			break
+		}
+
 		if !strings.HasPrefix(arg, "+") {
 			continue
 		}
@@ -377,7 +442,11 @@ func main() {
 	trace := flagSet.Bool("trace", false, "Print trace logs after exiting")
 
 	wrap := flagSet.Bool("wrap", false, "Wrap long lines")
-	follow := flagSet.Bool("follow", false, "Follow piped input just like \"tail -f\"")
+	inputEncoding := flagSet.String("encoding", "", "Input encoding, like UTF-16LE or latin1. Guessed if not set.")
+	lang := flagSet.String("lang", "", "Highlight input as this language, like python or go. Guessed if not set.")
+	table := flagSet.String("table", "", "Show input as a table: csv, tsv or off. Guessed from file names if not set.")
+	forceJson := flagSet.Bool("json", false, "Show input as JSON with folding. Guessed from contents if not set.")
+	follow := flagSet.Bool("follow", false, "Follow piped input just like \"tail -f\", or named files like \"tail -F\"")
 	style := flagSetFunc(flagSet,
 		"style", *styles.Registry["native"],
 		"Highlighting style from https://xyproto.github.io/splash/docs/longer/all.html", parseStyleOption)
@@ -403,6 +472,8 @@ func main() {
 	scrollRightHint := flagSetFunc(flagSet, "scroll-right-hint",
 		twin.NewCell('>', twin.StyleDefault.WithAttr(twin.AttrReverse)),
 		"Shown when view can scroll right. One character with optional ANSI highlighting.", parseScrollHint)
+	watch := flagSetFunc(flagSet, "watch", time.Duration(0),
+		"Re-run the command after '--' this often, like 2s", parseWatchInterval)
 	shift := flagSetFunc(flagSet, "shift", 16, "Horizontal scroll amount >=1, defaults to 16", parseShiftAmount)
 	mouseMode := flagSetFunc(
 		flagSet,
@@ -442,6 +513,36 @@ func main() {
 		os.Exit(0)
 	}
 
+	var readerOptions m.ReaderOptions
+	err = readerOptions.SetEncoding(*inputEncoding)
+	if err != nil {
+		boldErrorMessage := "\x1b[1m" + "Bad --encoding: " + err.Error() + "\x1b[m"
+		fmt.Fprintln(os.Stderr, "ERROR:", boldErrorMessage)
+		fmt.Fprintln(os.Stderr)
+		printUsage(os.Stderr, flagSet, true)
+		os.Exit(1)
+	}
+
+	err = readerOptions.SetLanguage(*lang)
+	if err != nil {
+		boldErrorMessage := "\x1b[1m" + "Bad --lang: " + err.Error() + "\x1b[m"
+		fmt.Fprintln(os.Stderr, "ERROR:", boldErrorMessage)
+		fmt.Fprintln(os.Stderr)
+		printUsage(os.Stderr, flagSet, true)
+		os.Exit(1)
+	}
+
+	err = readerOptions.SetTableFormat(*table)
+	if err != nil {
+		boldErrorMessage := "\x1b[1m" + "Bad --table: " + err.Error() + "\x1b[m"
+		fmt.Fprintln(os.Stderr, "ERROR:", boldErrorMessage)
+		fmt.Fprintln(os.Stderr)
+		printUsage(os.Stderr, flagSet, true)
+		os.Exit(1)
+	}
+
+	readerOptions.ForceJson(*forceJson)
+
 	log.SetLevel(log.InfoLevel)
 	if *trace {
 		log.SetLevel(log.TraceLevel)
@@ -453,31 +554,48 @@ func main() {
 		TimestampFormat: time.StampMicro,
 	})
 
-	if len(flagSet.Args()) > 1 {
-		fmt.Fprintln(os.Stderr, "ERROR: Expected exactly one filename, or data piped from stdin, got:", flagSet.Args())
-		fmt.Fprintln(os.Stderr)
-		printUsage(os.Stderr, flagSet, true)
-
-		os.Exit(1)
+	// "moar -- command arguments" pages the output of a command
+	var command []string
+	parsedArgsCount := len(remainingArgs) - len(flagSet.Args())
+	if parsedArgsCount > 0 && remainingArgs[parsedArgsCount-1] == "--" && flagSet.NArg() > 0 {
+		command = flagSet.Args()
 	}
 
 	stdinIsRedirected := !term.IsTerminal(int(os.Stdin.Fd()))
 	stdoutIsRedirected := !term.IsTerminal(int(os.Stdout.Fd()))
-	var inputFilename *string
-	if len(flagSet.Args()) == 1 {
-		word := flagSet.Args()[0]
-		inputFilename = &word
-
+	inputFilenames := flagSet.Args()
+	if command != nil {
+		inputFilenames = nil
+	}
+	for _, inputFilename := range inputFilenames {
 		// Need to check before twin.NewScreen() below, otherwise the screen
 		// will be cleared before we print the "No such file" error.
-		err := tryOpen(*inputFilename)
+		err := tryOpen(inputFilename)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
 		}
 	}
 
-	if inputFilename == nil && !stdinIsRedirected {
+	if *watch > 0 && command == nil {
+		boldErrorMessage := "\x1b[1m" + "--watch needs a command after '--'" + "\x1b[m"
+		fmt.Fprintln(os.Stderr, "ERROR:", boldErrorMessage)
+		fmt.Fprintln(os.Stderr)
+		printUsage(os.Stderr, flagSet, true)
+		os.Exit(1)
+	}
+
+	if command != nil {
+		// Need to check before twin.NewScreen() below, for the same reason as
+		// with the input files above
+		_, err := exec.LookPath(command[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(inputFilenames) == 0 && !stdinIsRedirected && command == nil {
 		fmt.Fprintln(os.Stderr, "ERROR: Filename or input pipe required")
 		fmt.Fprintln(os.Stderr)
 		printUsage(os.Stderr, flagSet, true)
@@ -485,7 +603,11 @@ func main() {
 	}
 
 	if stdoutIsRedirected {
-		err := pumpToStdout(inputFilename)
+		if command != nil {
+			runCommandToStdout(command)
+		}
+
+		err := pumpToStdout(inputFilenames)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
@@ -504,7 +626,11 @@ func main() {
 	if err != nil {
 		// Ref: https://github.com/walles/moar/issues/149
 		log.Debug("Failed to set up screen for paging, pumping to stdout instead: ", err)
-		err := pumpToStdout(inputFilename)
+		if command != nil {
+			runCommandToStdout(command)
+		}
+
+		err := pumpToStdout(inputFilenames)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
@@ -521,24 +647,44 @@ func main() {
 		formatter = formatters.TTY
 	}
 
-	var reader *m.Reader
-	if stdinIsRedirected {
+	var readers []*m.Reader
+	if command != nil {
+		reader, err := m.NewReaderFromCommandWithOptions(command, readerOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: Running %s failed: %v\n", command[0], err)
+			os.Exit(1)
+		}
+		if *watch > 0 {
+			reader.Watch(*watch)
+		}
+		readers = append(readers, reader)
+	} else if stdinIsRedirected {
 		// Display input pipe contents
-		reader = m.NewReaderFromStream("", os.Stdin)
+		readers = append(readers, m.NewHighlightingReaderFromStreamWithOptions("", os.Stdin, *style, formatter, readerOptions))
 	} else {
 		// Display the input file contents
-		reader, err = m.NewReaderFromFilename(*inputFilename, *style, formatter)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-			os.Exit(1)
+		for _, inputFilename := range inputFilenames {
+			reader, err := m.NewReaderFromFilenameWithOptions(inputFilename, *style, formatter, readerOptions)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+				os.Exit(1)
+			}
+			if *follow {
+				reader.FollowByName()
+			}
+			readers = append(readers, reader)
 		}
 	}
 
-	pager := m.NewPager(reader)
+	pager := m.NewPager(readers[0])
+	for _, reader := range readers[1:] {
+		pager.AddReader(reader)
+	}
 	pager.WrapLongLines = *wrap
 	pager.ShowLineNumbers = !*noLineNumbers
 	pager.ShowStatusBar = !*noStatusBar
 	pager.DeInit = !*noClearOnExit
+	pager.ReleaseReaders = true
 	pager.QuitIfOneScreen = *quitIfOneScreen
 	pager.StatusBarStyle = *statusBarStyle
 	pager.UnprintableStyle = *unprintableStyle
@@ -15,3 +15,14 @@ func TestParseScrollHint(t *testing.T) {
 		Style: twin.StyleDefault.WithAttr(twin.AttrReverse),
 	})
 }
+
+func TestGetTargetLineNumber(t *testing.T) {
+	lineNumber, args := getTargetLineNumberOneBased([]string{"+5", "file.txt"})
+	assert.Equal(t, lineNumber, 5)
+	assert.DeepEqual(t, args, []string{"file.txt"})
+
+	// Arguments after "--" belong to the command
+	lineNumber, args = getTargetLineNumberOneBased([]string{"--", "grep", "+5", "file.txt"})
+	assert.Equal(t, lineNumber, 0)
+	assert.DeepEqual(t, args, []string{"--", "grep", "+5", "file.txt"})
+}
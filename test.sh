@@ -68,6 +68,10 @@ echo Testing not crashing with different argument orders...
 ./moar --trace +123 moar.go >/dev/null
 ./moar --trace moar.go +123 >/dev/null
 
+echo Test redirecting multiple files by name into redirected stdout...
+./moar moar.go moar.go >"${RESULT}"
+diff -u <(cat moar.go moar.go) "${RESULT}"
+
 echo Test --version...
 ./moar --version >/dev/null # Should exit with code 0
 diff -u <(./moar --version) <(git describe --tags --dirty --always)